@@ -7,3 +7,5 @@ const UserIDKey = Key("userID")
 type contextKey string
 
 const DbContextKey contextKey = "db"
+
+const MatchQueueContextKey contextKey = "matchQueue"
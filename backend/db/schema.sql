@@ -5,7 +5,27 @@ CREATE TABLE users (
     email TEXT UNIQUE NOT NULL,
     bio TEXT,
     vector JSON DEFAULT '[3,3,3,3,3,3,3,3,3,3]',
-    profile_picture BLOB  -- New column for storing profile pictures
+    importance JSON,  -- importance of each answer in vector ("irrelevant", "a little", "very", "mandatory"), NULL until the user declares it
+    questionnaire_version INTEGER DEFAULT 1, -- questionnaire version the answers in vector belong to
+    profile_picture BLOB,  -- New column for storing profile pictures
+    time_zone TEXT DEFAULT 'America/Los_Angeles', -- IANA time zone the user's availability is expressed in
+    min_date_minutes INTEGER DEFAULT 30,         -- overlaps shorter than this are not offered as dates
+    slot_granularity_minutes INTEGER DEFAULT 30, -- overlaps are cut to slots on this grid: 15, 30, 60, 90 or 120
+    cancellation_count INTEGER DEFAULT 0, -- how many confirmed dates the user cancelled
+    gender TEXT CHECK (gender IN ('woman', 'man', 'nonbinary')),
+    seeking JSON,      -- genders the user wants to be matched with, NULL or empty for anyone
+    birth_date TEXT,   -- YYYY-MM-DD
+    class_year INTEGER, -- expected graduation year
+    major TEXT
+);
+
+CREATE TABLE match_filters (
+    user_id TEXT PRIMARY KEY,
+    min_age INTEGER, -- NULL for no limit; users without a birth_date never pass an age limit
+    max_age INTEGER,
+    min_class_year INTEGER, -- NULL for no limit; users without a class_year never pass a class year limit
+    max_class_year INTEGER,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
 CREATE TABLE availability (
@@ -17,6 +37,16 @@ CREATE TABLE availability (
     FOREIGN KEY(user_id) REFERENCES users(id)
 );
 
+CREATE TABLE availability_exceptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('add', 'remove')), -- extra free time, or a blackout on top of the weekly availability
+    exception_start TEXT NOT NULL, -- ISO 8601 format
+    exception_end TEXT NOT NULL,   -- same here
+    reason TEXT,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
 CREATE TABLE matches (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     user1_id TEXT NOT NULL,
@@ -25,17 +55,147 @@ CREATE TABLE matches (
     start_time TEXT NOT NULL,
     end_time TEXT NOT NULL,
     similarity_score REAL,
+    generation INTEGER NOT NULL DEFAULT 0, -- generation of user1's stored matches the row belongs to
     FOREIGN KEY(user1_id) REFERENCES users(id),
     FOREIGN KEY(user2_id) REFERENCES users(id)
 );
 
+CREATE INDEX idx_matches_user_generation ON matches(user1_id, generation);
+
+-- last complete generation of every user's stored matches, readers only see rows of this generation
+CREATE TABLE match_generations (
+    user_id TEXT PRIMARY KEY,
+    generation INTEGER NOT NULL,
+    total INTEGER NOT NULL DEFAULT 0, -- how many matches the user has, stored or not
+    computed_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
 CREATE TABLE scheduled_dates (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     user1_id TEXT NOT NULL,
     user2_id TEXT NOT NULL,
     date_start TEXT NOT NULL, -- we want this in ISO 8601 format
     date_end TEXT NOT NULL,   -- same here
-    status TEXT DEFAULT "pending", -- "pending", "confirmed", "rejected"
+    status TEXT DEFAULT "pending", -- "pending", "confirmed", "rejected", "withdrawn", "expired", "cancelled", "rescheduled"
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    cancelled_by TEXT,      -- user who cancelled or rescheduled a confirmed date
+    cancel_reason TEXT,
+    cancelled_at TEXT,
+    rescheduled_from INTEGER, -- id of the date this one replaces
     FOREIGN KEY(user1_id) REFERENCES users(id) ON DELETE CASCADE,
-    FOREIGN KEY(user2_id) REFERENCES users(id) ON DELETE CASCADE
+    FOREIGN KEY(user2_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(rescheduled_from) REFERENCES scheduled_dates(id) ON DELETE SET NULL
+);
+
+CREATE TABLE date_proposals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    date_id INTEGER NOT NULL,
+    round INTEGER NOT NULL, -- 1 for the first proposal, +1 for every counter-proposal
+    proposer_id TEXT NOT NULL,
+    status TEXT DEFAULT "open", -- "open", "countered", "accepted", "closed"
+    accepted_slot_id INTEGER,
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(date_id, round),
+    FOREIGN KEY(date_id) REFERENCES scheduled_dates(id) ON DELETE CASCADE,
+    FOREIGN KEY(proposer_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE date_proposal_slots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    proposal_id INTEGER NOT NULL,
+    slot_start TEXT NOT NULL, -- ISO 8601 format
+    slot_end TEXT NOT NULL,   -- same here
+    FOREIGN KEY(proposal_id) REFERENCES date_proposals(id) ON DELETE CASCADE
+);
+
+CREATE TABLE date_feedback (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    date_id INTEGER NOT NULL,
+    user_id TEXT NOT NULL, -- participant who wrote the feedback
+    rating INTEGER NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    would_meet_again BOOLEAN NOT NULL,
+    notes TEXT, -- private, only ever shown to the author
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(date_id, user_id),
+    FOREIGN KEY(date_id) REFERENCES scheduled_dates(id) ON DELETE CASCADE,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
 );
+
+CREATE TABLE calendar_tokens (
+    user_id TEXT PRIMARY KEY,
+    token_hash TEXT UNIQUE NOT NULL, -- sha256 of the token in the feed url, the token itself is never stored
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE questionnaire_versions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    is_active BOOLEAN NOT NULL DEFAULT FALSE, -- the version served by GET /quiz, only one at a time
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX one_active_questionnaire ON questionnaire_versions(is_active) WHERE is_active;
+
+CREATE TABLE questions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    version_id INTEGER NOT NULL,
+    position INTEGER NOT NULL, -- index of the answer in users.vector, from 0
+    prompt TEXT NOT NULL,
+    min_label TEXT, -- what the lowest answer means
+    max_label TEXT, -- what the highest answer means
+    min_value INTEGER NOT NULL DEFAULT 1,
+    max_value INTEGER NOT NULL DEFAULT 5,
+    UNIQUE(version_id, position),
+    CHECK (max_value > min_value),
+    FOREIGN KEY(version_id) REFERENCES questionnaire_versions(id) ON DELETE CASCADE
+);
+
+-- the questionnaire every user has answered so far
+INSERT INTO questionnaire_versions (id, is_active) VALUES (1, TRUE);
+INSERT INTO questions (version_id, position, prompt, min_label, max_label) VALUES
+(1, 0, 'How much do you talk?', 'Mute', 'Fluent in Yapanese'),
+(1, 1, 'How much do you like your alone time?', 'Always with people', 'Always alone'),
+(1, 2, 'How much do you like/listen to music?', 'What is a song', 'Can''t live without music'),
+(1, 3, 'How much do you like/play sports?', 'I don''t go outside', 'D1 athlete'),
+(1, 4, 'Do you enjoy partying/drinking?', 'Never', 'Wilding every night'),
+(1, 5, 'How chill are you?', 'Not so easygoing', 'Easygoing'),
+(1, 6, 'STEM or art?', 'Art', 'STEM'),
+(1, 7, 'How would you describe your life currently?', 'Absolute clownery', 'Have life together'),
+(1, 8, 'How fast is your response time?', 'Several days', 'Immediately'),
+(1, 9, 'What do you enjoy doing?', 'Watching a movie in bed', 'Adventuring in the Alps');
+
+CREATE TABLE match_actions (
+    user_id TEXT NOT NULL,   -- user who acted
+    target_id TEXT NOT NULL, -- user they acted on
+    action TEXT NOT NULL CHECK (action IN ('like', 'pass')), -- the latest action replaces earlier ones
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(user_id, target_id),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(target_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE user_blocks (
+    blocker_id TEXT NOT NULL, -- user who blocked
+    blocked_id TEXT NOT NULL, -- user they blocked, hidden from the blocker and the other way around
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(blocker_id, blocked_id),
+    FOREIGN KEY(blocker_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(blocked_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE user_reports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    reporter_id TEXT NOT NULL,
+    reported_id TEXT NOT NULL,
+    reason TEXT NOT NULL CHECK (reason IN ('harassment', 'spam', 'fake_profile', 'inappropriate', 'safety', 'other')),
+    details TEXT,             -- free text from the reporter
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved', 'dismissed')),
+    resolution TEXT,          -- note from the admin who closed the report
+    reviewed_by TEXT,         -- admin who closed the report
+    reviewed_at TEXT,
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(reporter_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(reported_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_reports_status ON user_reports(status, created_at);
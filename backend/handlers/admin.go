@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"go-react-backend/contextkeys"
+	"go-react-backend/models"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+/*
+GET /api/v1/admin/vectors/invalid: Lists users whose similarity vector cannot be compared against other users. These users are left out of everyone's matches until they retake the quiz.
+Only users listed in ADMIN_USER_IDS can use this endpoint.
+
+Returns:
+
+	200 OK: list of users, ordered by user id
+		[
+			{
+				"user_id": <user id> STRING,
+				"name": <user's name> STRING,
+				"vector": <the vector as stored, may be null or not valid JSON> STRING,
+				"questionnaire_version": <quiz version the vector claims to answer> INT,
+				"reason": <what is wrong with the vector> STRING
+			},
+			...
+		]
+	403 FORBIDDEN: the current user is not an admin
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func GetInvalidVectorsHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+
+	invalid, err := models.GetInvalidVectors(db)
+	if err != nil {
+		log.Printf("Failed to find invalid vectors: %v\n", err)
+		http.Error(w, "Failed to find invalid vectors", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invalid)
+}
+
+/*
+GET /api/v1/admin/reports: Lists the moderation queue, oldest reports first.
+Only users listed in ADMIN_USER_IDS can use this endpoint.
+
+Query Parameters:
+
+	status: only list reports with this status, "open", "resolved" or "dismissed" (default "open"), or "all"
+
+Returns:
+
+	200 OK:
+		[
+			{
+				"id": <report ID> INT,
+				"reporter_id": <user who reported> STRING,
+				"reporter_name": <their name> STRING,
+				"reported_id": <user who was reported> STRING,
+				"reported_name": <their name> STRING,
+				"reason": <"harassment", "spam", "fake_profile", "inappropriate", "safety" or "other"> STRING,
+				"details": <what happened, may be null> STRING,
+				"status": <"open", "resolved" or "dismissed"> STRING,
+				"resolution": <note from the admin who closed the report, may be null> STRING,
+				"reviewed_by": <admin who closed the report, null while open> STRING,
+				"reviewed_at": <when the report was closed, null while open> STRING,
+				"created_at": <when the report was made> STRING
+			},
+			...
+		]
+	400 BAD REQUEST: unknown status
+	403 FORBIDDEN: the current user is not an admin
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func GetReportsHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = models.ReportOpen
+	case "all":
+		status = ""
+	case models.ReportOpen, models.ReportResolved, models.ReportDismissed:
+	default:
+		log.Printf("Invalid report status: %q\n", status)
+		http.Error(w, "status must be open, resolved, dismissed or all", http.StatusBadRequest)
+		return
+	}
+
+	reports, err := models.GetReports(status, db)
+	if err != nil {
+		log.Printf("Failed to retrieve reports: %v\n", err)
+		http.Error(w, "Failed to retrieve reports", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+/*
+PATCH /api/v1/admin/reports/{reportId}: Closes an open report as resolved or dismissed. Closed reports cannot be changed.
+Only users listed in ADMIN_USER_IDS can use this endpoint.
+
+Request Body:
+
+	{
+		"status": <"resolved" or "dismissed"> STRING,
+		"resolution": <note on what was done, optional> STRING
+	}
+
+Returns:
+
+	200 OK: the closed report, in the same format as GET /api/v1/admin/reports
+	400 BAD REQUEST: invalid JSON or status
+	403 FORBIDDEN: the current user is not an admin
+	404 NOT FOUND: no report with reportId exists
+	409 CONFLICT: the report was already closed:
+		{
+			"error": "report_closed",
+			"message": "Report is already closed",
+			"report": <the report>
+		}
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func PatchReportHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	reportID, err := strconv.Atoi(mux.Vars(r)["reportId"])
+	if err != nil {
+		log.Printf("Invalid report id: %v\n", err)
+		http.Error(w, "Invalid report id", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Status     string  `json:"status"`
+		Resolution *string `json:"resolution"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Invalid request body: %v\n", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if request.Status != models.ReportResolved && request.Status != models.ReportDismissed {
+		log.Printf("Invalid report status: %q\n", request.Status)
+		http.Error(w, "status must be resolved or dismissed", http.StatusBadRequest)
+		return
+	}
+
+	report, err := models.CloseReport(reportID, request.Status, request.Resolution, userID, db)
+	if errors.Is(err, models.ErrReportNotFound) {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, models.ErrReportClosed) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":   "report_closed",
+			"message": "Report is already closed",
+			"report":  report,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to close report %d: %v\n", reportID, err)
+		http.Error(w, "Failed to close report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"go-react-backend/contextkeys" // access request context
 	"go-react-backend/models"      // interact with db
 	"log"
@@ -15,6 +16,12 @@ import (
 
 /*
 GET/api/v1/availability: get all timeslots for the current user.
+Times are in the user's time_zone, unless another zone is requested with the "tz" query parameter.
+
+Request Params:
+
+	tz: IANA time zone to render the timeslots in, e.g. "America/New_York" (optional).
+		A timeslot that crosses midnight in that zone is returned as two entries with the same id.
 
 Return:
 
@@ -26,6 +33,7 @@ Return:
 			"end_time": <HH:MM:SS> STRING
 			"day_of_week": <Monday - Sunday> STRING
 		}
+	400 Bad Request: unknown tz
 	500 Internal Error: not able to get availability
 */
 func GetAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
@@ -40,6 +48,23 @@ func GetAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// render in another zone if requested
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		viewerLoc, err := models.LoadTimeZone(tz)
+		if err != nil {
+			log.Printf("Invalid tz provided (%s): %v\n", tz, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		userLoc, err := models.GetUserLocation(userID, db)
+		if err != nil {
+			log.Printf("Error getting user's time zone: %v\n", err)
+			http.Error(w, "Failed to get time zone", http.StatusInternalServerError)
+			return
+		}
+		availability = models.ConvertAvailability(availability, userLoc, viewerLoc)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(availability)
 }
@@ -125,12 +150,7 @@ func PostAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// update matches with new availability
-	err = models.UpdateMatches(userID, db)
-	if err != nil {
-		log.Printf("Error updating user's matches: %v\n", err)
-		http.Error(w, "Error updating matches", http.StatusInternalServerError)
-		return
-	}
+	QueueMatchUpdate(r, userID)
 
 	// Respond with success
 	w.WriteHeader(http.StatusOK)
@@ -192,12 +212,7 @@ func PutAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update match based on availability
-	err := models.UpdateMatches(userID, db)
-	if err != nil {
-		log.Printf("Failed to update matches: %v\n", err)
-		http.Error(w, "Error updating matches", http.StatusInternalServerError)
-		return
-	}
+	QueueMatchUpdate(r, userID)
 
 	// Respond with a success message
 	w.WriteHeader(http.StatusOK)
@@ -207,7 +222,7 @@ func PutAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 /*
-DELETE /api/v1/availability: Deletes a time slot from `availability` by ID, if it belongs to the current user.
+DELETE /api/v1/availability: Deletes a time slot from `availability` by ID, if it belongs to the current user. Matches are recomputed in the background.
 
 Request Body: A JSON object containing the ID of the time slot to delete:
 
@@ -248,6 +263,9 @@ func DeleteAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Update match based on availability
+	QueueMatchUpdate(r, req.UserID)
+
 	// Respond with a success message
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
@@ -255,8 +273,98 @@ func DeleteAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+/*
+PUT /api/v1/availability/bulk: Replaces the whole weekly availability of the current user in one go.
+Timeslots that touch or overlap on the same day are merged, the result is diffed against the current entries and applied in a single transaction, and matches are recomputed once, in the background.
+Times are in the user's time_zone, and are rounded to whole minutes. An empty list clears the availability.
+
+Request Body: The complete desired schedule, ids are ignored
+
+	[
+		{
+			"start_time": <start time in HH:MM:SS or HH:MM format, e.g., "10:00">,
+			"end_time": <end time in HH:MM:SS or HH:MM format, e.g., "11:00">,
+			"day_of_week": <day of the week, e.g., "Monday">
+		},
+		...
+	]
+
+Return:
+
+	200 OK: Returns the new availability, in the same format as GET /api/v1/availability, and what was changed
+		{
+			"availability": [...],
+			"changes": {
+				"inserted": <entries added> INT,
+				"updated": <existing entries moved to a new time> INT,
+				"deleted": <entries removed> INT,
+				"unchanged": <entries that were already there> INT
+			}
+		}
+	400 BAD REQUEST: Returns an error message if the request body is malformed, or any timeslot is invalid. Nothing is changed.
+	500 INTERNAL ERROR: Returns an error message if the schedule could not be saved. Nothing is changed.
+*/
+func PutAvailabilityBulkHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	var schedule []models.Availability
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		log.Printf("Provided schedule was not formatted correctly: %v\n", err)
+		http.Error(w, "Invalid request payload, must be a JSON list of timeslots", http.StatusBadRequest)
+		return
+	}
+
+	for i := range schedule {
+		if len(schedule[i].StartTime) == 5 { // "HH:MM" length
+			schedule[i].StartTime += ":00"
+		}
+		if len(schedule[i].EndTime) == 5 { // "HH:MM" length
+			schedule[i].EndTime += ":00"
+		}
+		if err := ValidateTimeslot(schedule[i]); err != nil {
+			log.Printf("Provided timeslot is invalid: %v\n", err)
+			http.Error(w, fmt.Sprintf("timeslot %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	changes, err := models.ReplaceAvailability(userID, models.MergeWeeklySlots(schedule), db)
+	if err != nil {
+		log.Printf("Error replacing availability: %v\n", err)
+		http.Error(w, "Failed to set availability", http.StatusInternalServerError)
+		return
+	}
+
+	// update matches once for the whole schedule
+	if changes.Inserted+changes.Updated+changes.Deleted > 0 {
+		QueueMatchUpdate(r, userID)
+	}
+
+	availability, err := models.GetAvailability(userID, db)
+	if err != nil {
+		log.Printf("Error querying for user's availability: %v\n", err)
+		http.Error(w, "Failed to get availability", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"availability": availability,
+		"changes":      changes,
+	})
+}
+
 /* HELPER FUNCTIONS */
 
+// ViewerLocation returns the zone requested with the "tz" query parameter, or the time zone of userID
+func ViewerLocation(r *http.Request, userID string, db *sql.DB) (*time.Location, error) {
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		return models.LoadTimeZone(tz)
+	}
+	return models.GetUserLocation(userID, db)
+}
+
 // ValidateTimeslot checks if the provided Availability struct has a valid structure.
 func ValidateTimeslot(avail models.Availability) error {
 	// Valid days of the week
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"go-react-backend/contextkeys"
+	"go-react-backend/models"
+	"log"
+	"net/http"
+	"time"
+)
+
+// longest range a single availability exception can cover
+const MAX_EXCEPTION_DAYS = 366
+
+/*
+GET /api/v1/availability/exceptions: get all availability exceptions of the current user, earliest first.
+Exceptions add ("add") or remove ("remove") a concrete range of time on top of the weekly availability, e.g. "free this Saturday only" or "not available Dec 20 - Jan 5".
+
+Return:
+
+	200 OK: list of exceptions returned in JSON format
+		{
+			"id": <unique ID for each exception> INT
+			"user_id": <corresponding user> STRING
+			"kind": <"add" or "remove"> STRING
+			"start": <start of the range> ISO 8601 format
+			"end": <end of the range> ISO 8601 format
+			"reason": <optional note> STRING
+		}
+	500 Internal Error: not able to get exceptions
+*/
+func GetAvailabilityExceptionsHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	exceptions, err := models.GetAvailabilityExceptions(userID, db)
+	if err != nil {
+		log.Printf("Error querying for user's availability exceptions: %v\n", err)
+		http.Error(w, "Failed to get availability exceptions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exceptions)
+}
+
+/*
+POST /api/v1/availability/exceptions: Adds an availability exception for the current user. Exceptions may overlap each other and the weekly availability; "remove" always wins over "add".
+
+Request Body:
+
+	{
+		"kind": <"add" or "remove"> STRING,
+		"start": <start of the range, e.g. "2026-12-20T00:00:00-08:00"> ISO 8601 format,
+		"end": <end of the range, at most 366 days after start> ISO 8601 format,
+		"reason": <optional note, e.g. "winter break"> STRING
+	}
+
+Return:
+
+	200 OK: Returns the new exception, in the same format as GET /api/v1/availability/exceptions
+	400 BAD REQUEST: Returns an error message if the request body is malformed or the exception is invalid.
+	500 INTERNAL ERROR: Returns an error message if the exception could not be saved.
+*/
+func PostAvailabilityExceptionHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	var exception models.AvailabilityException
+	if err := json.NewDecoder(r.Body).Decode(&exception); err != nil {
+		log.Printf("Provided availability exception was not formatted correctly: %v\n", err)
+		http.Error(w, "Invalid request payload, must be well formatted JSON", http.StatusBadRequest)
+		return
+	}
+	exception.UserID = userID
+
+	if err := ValidateAvailabilityException(exception); err != nil {
+		log.Printf("Provided availability exception is invalid: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := models.PostAvailabilityException(exception, db)
+	if err != nil {
+		log.Printf("Error posting availability exception: %v\n", err)
+		http.Error(w, "Failed to add availability exception", http.StatusInternalServerError)
+		return
+	}
+	exception.ID = id
+
+	// update matches with the new exception
+	QueueMatchUpdate(r, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exception)
+}
+
+/*
+PUT /api/v1/availability/exceptions: Updates an availability exception of the current user.
+
+Request Body: same as POST /api/v1/availability/exceptions, with the id of the exception to update
+
+	{
+		"id": <ID of the exception to update> INT,
+		"kind": <"add" or "remove"> STRING,
+		"start": <start of the range> ISO 8601 format,
+		"end": <end of the range> ISO 8601 format,
+		"reason": <optional note> STRING
+	}
+
+Return:
+
+	200 OK: Returns the updated exception
+	400 BAD REQUEST: Returns an error message if the request body is malformed or the exception is invalid.
+	500 INTERNAL ERROR: Returns an error message if the exception could not be updated, e.g. it does not belong to the current user.
+*/
+func PutAvailabilityExceptionHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	var exception models.AvailabilityException
+	if err := json.NewDecoder(r.Body).Decode(&exception); err != nil {
+		log.Printf("Provided availability exception is poorly formatted: %v\n", err)
+		http.Error(w, "Invalid request payload, must be well formatted JSON", http.StatusBadRequest)
+		return
+	}
+	exception.UserID = userID
+
+	if exception.ID == 0 {
+		log.Print("Request body must contain an availability exception ID")
+		http.Error(w, "Request body must contain an 'id'", http.StatusBadRequest)
+		return
+	}
+	if err := ValidateAvailabilityException(exception); err != nil {
+		log.Printf("Provided availability exception is invalid: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := models.PutAvailabilityException(exception, db); err != nil {
+		log.Printf("Error updating availability exception: %v\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// update matches with the changed exception
+	QueueMatchUpdate(r, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exception)
+}
+
+/*
+DELETE /api/v1/availability/exceptions: Deletes an availability exception by ID, if it belongs to the current user.
+
+Request Body:
+
+	{
+		"id": <ID of the exception to delete> INT
+	}
+
+Return:
+
+	200 OK: Returns a success message confirming that the exception was deleted.
+	400 BAD REQUEST: Returns an error message if the provided ID is in an invalid format or missing.
+	500 INTERNAL ERROR: Returns an error message if the deletion fails.
+*/
+func DeleteAvailabilityExceptionHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	var request struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Invalid request body provided: %v\n", err)
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+	if request.ID == 0 {
+		log.Print("Request body must contain an availability exception ID")
+		http.Error(w, "Request body must contain an 'id'", http.StatusBadRequest)
+		return
+	}
+
+	if err := models.DeleteAvailabilityException(request.ID, userID, db); err != nil {
+		log.Printf("Error deleting availability exception: %v\n", err)
+		http.Error(w, "Error deleting availability exception", http.StatusInternalServerError)
+		return
+	}
+
+	// update matches without the exception
+	QueueMatchUpdate(r, userID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Availability exception successfully deleted",
+	})
+}
+
+// ValidateAvailabilityException checks the kind of an exception, and that it covers a valid range of time
+func ValidateAvailabilityException(exception models.AvailabilityException) error {
+	if exception.Kind != models.ExceptionAdd && exception.Kind != models.ExceptionRemove {
+		return errors.New("invalid kind; must be \"add\" or \"remove\"")
+	}
+
+	start, err := time.Parse(time.RFC3339, exception.Start)
+	if err != nil {
+		return errors.New("invalid start format; must be ISO 8601, e.g. 2026-12-20T00:00:00-08:00")
+	}
+	end, err := time.Parse(time.RFC3339, exception.End)
+	if err != nil {
+		return errors.New("invalid end format; must be ISO 8601, e.g. 2027-01-05T00:00:00-08:00")
+	}
+
+	if !start.Before(end) {
+		return errors.New("start must be earlier than end")
+	}
+	if end.Sub(start) > MAX_EXCEPTION_DAYS*24*time.Hour {
+		return errors.New("an exception can cover at most 366 days")
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"go-react-backend/contextkeys"
+	"go-react-backend/ical"
+	"go-react-backend/models"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// largest .ics file accepted by the import, in bytes
+const MAX_CALENDAR_UPLOAD = 1 << 20
+
+/*
+POST /api/v1/availability/import: Imports weekly availability for the current user from an iCalendar (.ics) file.
+Single events, daily and weekly recurring events (RRULE:FREQ=DAILY or FREQ=WEEKLY, with INTERVAL, COUNT, UNTIL, BYDAY and EXDATE) and VFREEBUSY busy blocks are treated as busy time,
+and every free window left inside the daily window becomes an availability entry. Only the occurrences and busy blocks that fall in the imported week count.
+Transparent and cancelled events do not block time. Files with other recurrence rules (e.g. FREQ=MONTHLY) or RDATE are refused, rather than imported as free time the user does not have.
+
+The file is sent either as multipart/form-data in the field "file", or as the raw request body (text/calendar). At most 1MB.
+Recurring events repeat in the time zone of their DTSTART. Free windows are computed in the user's time_zone, which is also used for times without a zone in the file.
+
+Query Parameters:
+
+	week_of: YYYY-MM-DD, a day of the week whose single events are imported (default: the 7 days starting today)
+	day_start: HH:MM, earliest time that can be free (default: "08:00")
+	day_end: HH:MM, latest time that can be free (default: "22:00")
+	min_minutes: shortest free window to import, in minutes (default: 30)
+
+Returns:
+
+	200 OK: Free windows that overlap an existing availability entry are skipped and reported instead of failing the whole import
+		{
+			"imported": [
+				{
+					"id": 0,
+					"user_id": <current user> STRING,
+					"start_time": <HH:MM:SS> STRING,
+					"end_time": <HH:MM:SS> STRING,
+					"day_of_week": <Monday - Sunday> STRING
+				},
+				...
+			],
+			"collisions": [
+				{
+					"slot": <free window that was not imported, same format as above>,
+					"conflict": <existing availability entry it overlaps, same format as GET /api/v1/availability>
+				},
+				...
+			]
+		}
+	400 BAD REQUEST: the file is missing, too large or not a valid iCalendar file, it has an unsupported recurrence rule, or a query parameter is invalid
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func ImportAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	loc, err := models.GetUserLocation(userID, db)
+	if err != nil {
+		log.Printf("Error getting user's time zone: %v\n", err)
+		http.Error(w, "Failed to get time zone", http.StatusInternalServerError)
+		return
+	}
+	opts, err := ParseFreeWindowOptions(r, loc)
+	if err != nil {
+		log.Printf("Invalid import options: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	file, err := ReadCalendarUpload(w, r)
+	if err != nil {
+		log.Printf("Failed to read calendar upload: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	calendar, err := ical.Parse(bytes.NewReader(file), opts.Location)
+	if err != nil {
+		log.Printf("Failed to parse calendar: %v\n", err)
+		http.Error(w, "Invalid iCalendar file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	type collision struct {
+		Slot     models.Availability  `json:"slot"`
+		Conflict *models.Availability `json:"conflict"`
+	}
+	imported := []models.Availability{}
+	collisions := []collision{}
+
+	for _, window := range models.FreeWindows(userID, calendar, opts) {
+		overlap, err := models.GetOverlapping(window, db)
+		if err != nil {
+			log.Printf("Error checking for overlapping availabilities: %v\n", err)
+			http.Error(w, "Failed to check overlap", http.StatusInternalServerError)
+			return
+		}
+		if overlap != nil {
+			collisions = append(collisions, collision{Slot: window, Conflict: overlap})
+			continue
+		}
+
+		if err := models.PostAvailability(window, db); err != nil {
+			log.Printf("Error posting availability: %v\n", err)
+			http.Error(w, "Failed to set availability", http.StatusInternalServerError)
+			return
+		}
+		imported = append(imported, window)
+	}
+
+	// update matches once for the whole import
+	if len(imported) > 0 {
+		QueueMatchUpdate(r, userID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"imported":   imported,
+		"collisions": collisions,
+	})
+}
+
+// HELPER FUNC: Read the uploaded .ics file, either from the multipart field "file" or from the raw body
+func ReadCalendarUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_CALENDAR_UPLOAD)
+
+	var body io.Reader = r.Body
+	if err := r.ParseMultipartForm(MAX_CALENDAR_UPLOAD); err == nil {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, errors.New("multipart upload must contain a \"file\" field")
+		}
+		defer file.Close()
+		body = file
+	} else if !errors.Is(err, http.ErrNotMultipart) {
+		return nil, errors.New("invalid upload, the file must be at most 1MB")
+	}
+
+	file, err := io.ReadAll(body)
+	if err != nil {
+		return nil, errors.New("invalid upload, the file must be at most 1MB")
+	}
+	if len(file) == 0 {
+		return nil, errors.New("no calendar file provided")
+	}
+	return file, nil
+}
+
+// HELPER FUNC: Read the free window options of an import in the zone loc from the query parameters, falling back to the defaults
+func ParseFreeWindowOptions(r *http.Request, loc *time.Location) (models.FreeWindowOptions, error) {
+	query := r.URL.Query()
+	opts := models.FreeWindowOptions{
+		Location:   loc,
+		DayStart:   8 * 60,
+		DayEnd:     22 * 60,
+		MinMinutes: 30,
+	}
+
+	opts.WeekStart = time.Now().In(opts.Location)
+	if weekOf := query.Get("week_of"); weekOf != "" {
+		day, err := time.ParseInLocation("2006-01-02", weekOf, opts.Location)
+		if err != nil {
+			return opts, errors.New("invalid week_of, must be YYYY-MM-DD")
+		}
+		opts.WeekStart = day
+	}
+
+	for param, minutes := range map[string]*int{"day_start": &opts.DayStart, "day_end": &opts.DayEnd} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse("15:04", value)
+		if err != nil {
+			return opts, errors.New("invalid " + param + ", must be HH:MM")
+		}
+		*minutes = t.Hour()*60 + t.Minute()
+	}
+	if opts.DayStart >= opts.DayEnd {
+		return opts, errors.New("day_start must be earlier than day_end")
+	}
+
+	if value := query.Get("min_minutes"); value != "" {
+		minMinutes, err := strconv.Atoi(value)
+		if err != nil || minMinutes < 1 {
+			return opts, errors.New("invalid min_minutes, must be a positive number")
+		}
+		opts.MinMinutes = minMinutes
+	}
+	return opts, nil
+}
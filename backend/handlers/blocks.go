@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"go-react-backend/contextkeys"
+	"go-react-backend/models"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// longest details a report can have, in characters
+const MAX_REPORT_DETAILS_LENGTH = 2000
+
+/*
+POST /api/v1/users/{userId}/block: Blocks another user. Blocking is mutual in effect: neither user sees the other in users, matches or availability, and neither can propose a date to the other.
+Blocking an already blocked user is a no-op.
+
+Returns:
+
+	204 NO CONTENT: the user is blocked
+	400 BAD REQUEST: the current user tried to block themselves
+	404 NOT FOUND: no user with userId exists
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func PostBlockHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+	targetID := mux.Vars(r)["userId"]
+
+	if targetID == userID {
+		log.Printf("User tried to block themselves\n")
+		http.Error(w, "Cannot block yourself", http.StatusBadRequest)
+		return
+	}
+	if !CheckUserExists(w, targetID, db) {
+		return
+	}
+
+	if err := models.BlockUser(userID, targetID, db); err != nil {
+		log.Printf("Failed to block user %s: %v\n", targetID, err)
+		http.Error(w, "Failed to block user", http.StatusInternalServerError)
+		return
+	}
+
+	// the pair left both stored match lists, which may now have room for another user
+	QueueMatchUpdate(r, userID)
+	QueueMatchUpdate(r, targetID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+DELETE /api/v1/users/{userId}/block: Removes a block the current user placed on another user. A block placed by the other user stays in effect.
+Matches of the current user are recomputed in the background, so the pair can be matched again.
+
+Returns:
+
+	204 NO CONTENT: the block was removed
+	404 NOT FOUND: the current user has not blocked userId
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func DeleteBlockHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+	targetID := mux.Vars(r)["userId"]
+
+	err := models.UnblockUser(userID, targetID, db)
+	if errors.Is(err, models.ErrBlockNotFound) {
+		http.Error(w, "User is not blocked", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to unblock user %s: %v\n", targetID, err)
+		http.Error(w, "Failed to unblock user", http.StatusInternalServerError)
+		return
+	}
+
+	// the pair can be matched again
+	QueueMatchUpdate(r, userID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+GET /api/v1/users/me/blocks: Lists the users the current user blocked, most recent first.
+
+Returns:
+
+	200 OK:
+		[
+			{
+				"user_id": <blocked user ID> STRING,
+				"name": <blocked user's name> STRING,
+				"created_at": <when they were blocked> STRING
+			},
+			...
+		]
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func GetBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	blocks, err := models.GetBlockedUsers(userID, db)
+	if err != nil {
+		log.Printf("Failed to retrieve blocked users: %v\n", err)
+		http.Error(w, "Failed to retrieve blocked users", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blocks)
+}
+
+/*
+POST /api/v1/users/{userId}/report: Reports another user to the moderators. The report lands in the moderation queue as open.
+Setting block also blocks the user, as POST /api/v1/users/{userId}/block does.
+
+Request Body:
+
+	{
+		"reason": <one of "harassment", "spam", "fake_profile", "inappropriate", "safety", "other"> STRING,
+		"details": <what happened, optional, at most 2000 characters> STRING,
+		"block": <also block the user, optional> BOOL
+	}
+
+Returns:
+
+	201 CREATED:
+		{
+			"id": <report ID> INT,
+			"status": "open" STRING,
+			"blocked": <true if the user was blocked too> BOOL
+		}
+	400 BAD REQUEST: invalid JSON, unknown reason, details too long, or the current user reported themselves
+	404 NOT FOUND: no user with userId exists
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func PostReportHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+	targetID := mux.Vars(r)["userId"]
+
+	var request struct {
+		Reason  string  `json:"reason"`
+		Details *string `json:"details"`
+		Block   bool    `json:"block"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Invalid request body: %v\n", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if targetID == userID {
+		log.Printf("User tried to report themselves\n")
+		http.Error(w, "Cannot report yourself", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(models.REPORT_REASONS, request.Reason) {
+		log.Printf("Invalid report reason: %q\n", request.Reason)
+		http.Error(w, "reason must be one of "+strings.Join(models.REPORT_REASONS, ", "), http.StatusBadRequest)
+		return
+	}
+	if request.Details != nil && len([]rune(*request.Details)) > MAX_REPORT_DETAILS_LENGTH {
+		log.Printf("Report details are too long\n")
+		http.Error(w, "details are too long", http.StatusBadRequest)
+		return
+	}
+	if !CheckUserExists(w, targetID, db) {
+		return
+	}
+
+	id, err := models.PostReport(userID, targetID, request.Reason, request.Details, db)
+	if err != nil {
+		log.Printf("Failed to report user %s: %v\n", targetID, err)
+		http.Error(w, "Failed to report user", http.StatusInternalServerError)
+		return
+	}
+
+	if request.Block {
+		if err := models.BlockUser(userID, targetID, db); err != nil {
+			log.Printf("Failed to block user %s: %v\n", targetID, err)
+			http.Error(w, "Failed to block user", http.StatusInternalServerError)
+			return
+		}
+		QueueMatchUpdate(r, userID)
+		QueueMatchUpdate(r, targetID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      id,
+		"status":  models.ReportOpen,
+		"blocked": request.Block,
+	})
+}
+
+// HELPER FUNC: Make sure a user with userID exists. Returns false if an error response was written.
+func CheckUserExists(w http.ResponseWriter, userID string, db *sql.DB) bool {
+	if _, err := models.GetUserByID(userID, db); err != nil {
+		log.Printf("Failed to retrieve user %s: %v\n", userID, err)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return false
+		}
+		http.Error(w, "Error getting user", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// HELPER FUNC: Make sure neither user of date blocked the other. userID is the current user, the response names the other one.
+// Returns false if an error response was written.
+func CheckNotBlocked(w http.ResponseWriter, date models.Date, userID string, db *sql.DB) bool {
+	blocked, err := models.IsBlocked(date.User1ID, date.User2ID, db)
+	if err != nil {
+		log.Printf("Failed to check block: %v\n", err)
+		http.Error(w, "Failed to check block", http.StatusInternalServerError)
+		return false
+	}
+	if blocked {
+		log.Printf("Users %s and %s have blocked each other\n", date.User1ID, date.User2ID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":   "blocked",
+			"message": "Dates cannot be proposed to this user",
+			"user_id": date.OtherUserID(userID),
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-react-backend/contextkeys"
+	"go-react-backend/ical"
+	"go-react-backend/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+/*
+GET /api/v1/dates.ics: Exports all dates of the current user as an iCalendar (RFC 5545) file.
+
+Returns:
+
+	200 OK: text/calendar file with one VEVENT per date
+		UID: "date-<date id>@bdate", stable across exports
+		SUMMARY: "Date with <other user's name>"
+		STATUS: TENTATIVE for pending dates, CONFIRMED for confirmed dates, CANCELLED for every other status
+	500 INTERNAL ERROR: could not get the user's dates
+*/
+func GetDatesCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	WriteDatesCalendar(w, userID, db)
+}
+
+/*
+GET /api/v1/dates/{dateId}.ics: Exports a single date of the current user as an iCalendar (RFC 5545) file.
+
+Returns:
+
+	200 OK: text/calendar file with a single VEVENT, in the same format as GET /api/v1/dates.ics
+	400 BAD REQUEST: invalid dateId
+	403 FORBIDDEN: the current user is not a participant of the date
+	404 NOT FOUND: no date with dateId exists
+	500 INTERNAL ERROR: could not export the date
+*/
+func GetDateCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	date, ok := GetRequestedDate(w, r, db)
+	if !ok {
+		return
+	}
+	if _, err := models.DateRoleOf(date, userID); err != nil {
+		log.Printf("User is not a participant of date %d\n", date.ID)
+		http.Error(w, "Not a participant of this date", http.StatusForbidden)
+		return
+	}
+
+	events, err := DateEvents([]models.Date{*date}, userID, db)
+	if err != nil {
+		log.Printf("Failed to export date %d: %v\n", date.ID, err)
+		http.Error(w, "Failed to export date", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="date-%d.ics"`, date.ID))
+	if err := ical.WriteCalendar(w, "bdate", events); err != nil {
+		log.Printf("Error writing calendar: %v\n", err)
+	}
+}
+
+/*
+POST /api/v1/dates/feed-token: Creates a calendar feed url for the current user, so calendar apps can subscribe to their dates without a JWT.
+Calling this again replaces the previous url, which stops working.
+
+Returns:
+
+	200 OK:
+		{
+			"token": <secret feed token> STRING,
+			"feed_url": <url to subscribe to, e.g. "http://localhost:8080/api/v1/public/calendar/<token>.ics"> STRING
+		}
+	500 INTERNAL ERROR: could not create a token
+*/
+func PostCalendarTokenHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	token, err := models.RotateCalendarToken(userID, db)
+	if err != nil {
+		log.Printf("Failed to create calendar token: %v\n", err)
+		http.Error(w, "Failed to create calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"token":    token,
+		"feed_url": fmt.Sprintf("%s://%s/api/v1/public/calendar/%s.ics", scheme, r.Host, token),
+	})
+}
+
+/*
+GET /api/v1/public/calendar/{token}.ics: Calendar feed for the user a feed token belongs to. Does NOT need a JWT, the token authenticates the request.
+
+Returns:
+
+	200 OK: text/calendar file, in the same format as GET /api/v1/dates.ics
+	404 NOT FOUND: the token is unknown or was replaced
+	500 INTERNAL ERROR: could not export the dates
+*/
+func GetCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	token := mux.Vars(r)["token"]
+
+	userID, err := models.GetUserIDByCalendarToken(token, db)
+	if err != nil {
+		log.Printf("Failed to look up calendar feed: %v\n", err)
+		if errors.Is(err, models.ErrInvalidCalendarToken) {
+			http.Error(w, "Calendar feed not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to export dates", http.StatusInternalServerError)
+		return
+	}
+
+	WriteDatesCalendar(w, userID, db)
+}
+
+// HELPER FUNC: Respond with all dates of userID as an iCalendar file
+func WriteDatesCalendar(w http.ResponseWriter, userID string, db *sql.DB) {
+	dates, err := models.GetDates(userID, "", db)
+	if err != nil {
+		log.Printf("Error getting dates: %v\n", err)
+		http.Error(w, "Failed to get dates", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := DateEvents(dates, userID, db)
+	if err != nil {
+		log.Printf("Failed to export dates: %v\n", err)
+		http.Error(w, "Failed to export dates", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="dates.ics"`)
+	if err := ical.WriteCalendar(w, "bdate", events); err != nil {
+		log.Printf("Error writing calendar: %v\n", err)
+	}
+}
+
+// HELPER FUNC: Convert dates into calendar events, as seen by viewerID
+func DateEvents(dates []models.Date, viewerID string, db *sql.DB) ([]ical.Event, error) {
+	names := make(map[string]string) // other participant's id -> name
+	var events []ical.Event
+
+	for _, date := range dates {
+		start, err := time.Parse(time.RFC3339, date.DateStart)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date_start for date %d: %w", date.ID, err)
+		}
+		end, err := time.Parse(time.RFC3339, date.DateEnd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date_end for date %d: %w", date.ID, err)
+		}
+		stamp, err := time.Parse(time.DateTime, date.CreatedAt)
+		if err != nil {
+			stamp = time.Now()
+		}
+
+		otherID := date.User2ID
+		if otherID == viewerID {
+			otherID = date.User1ID
+		}
+		name, ok := names[otherID]
+		if !ok {
+			other, err := models.GetUserByID(otherID, db)
+			if err != nil {
+				return nil, err
+			}
+			name = other.Name
+			names[otherID] = name
+		}
+
+		events = append(events, ical.Event{
+			UID:     fmt.Sprintf("date-%d@bdate", date.ID),
+			Summary: "Date with " + name,
+			Start:   start,
+			End:     end,
+			Stamp:   stamp,
+			Status:  CalendarStatus(date.Status),
+		})
+	}
+
+	return events, nil
+}
+
+// HELPER FUNC: Map a date status to a VEVENT STATUS
+func CalendarStatus(status string) string {
+	switch status {
+	case models.StatusPending:
+		return ical.StatusTentative
+	case models.StatusConfirmed:
+		return ical.StatusConfirmed
+	default:
+		return ical.StatusCancelled
+	}
+}
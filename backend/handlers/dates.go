@@ -9,6 +9,7 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -19,11 +20,11 @@ GET /api/v1/dates/status?: Retrieves the dates for the current user. Optionally
 
 Request Params:
 
-	"status" = "pending", "confirmed", "rejected"
+	"status" = "pending", "confirmed", "rejected", "withdrawn", "expired", "cancelled", "rescheduled"
 
 Example:
 
-	GET `/api/v1/dates/pending` would return only pending dates.
+	GET `/api/v1/dates/pending` would return only pending dates. Pending dates that already started are left out, since they are about to expire.
 
 Returns:
 
@@ -34,7 +35,17 @@ Returns:
 			"user2_id": <other user id > STRING,
 			"date_start": "<date_start> ISO 8601 format",
 			"date_end": "<date_end> ISO 8601 format",
-			"status": <"pending", "confimed", "rejected">
+			"status": <"pending", "confirmed", "rejected", "withdrawn", "expired", "cancelled", "rescheduled">,
+			"created_at": <when the date was proposed> STRING,
+			"cancelled_by": <user who cancelled or rescheduled the date, only for cancelled/rescheduled dates> STRING,
+			"cancel_reason": <why, only for cancelled/rescheduled dates> STRING,
+			"cancelled_at": <when, only for cancelled/rescheduled dates> STRING,
+			"rescheduled_from": <id of the date this one replaces, only for rescheduled dates> INT,
+			"feedback": {
+				"count": <how many participants left feedback, 0 to 2> INT,
+				"mutual_meet_again": <true once both participants would meet again> BOOL,
+				"submitted_by_me": <whether the current user left feedback> BOOL
+			}
 	    }
 	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
 	400 BAD REQUEST: Returns an error message if the request is invalid (e.g., invalid matchId format).
@@ -55,6 +66,14 @@ func GetDatesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// attach how each date went
+	err = models.AttachFeedbackSummaries(dates, userID, db)
+	if err != nil {
+		log.Printf("Error getting feedback for dates: %v\n", err)
+		http.Error(w, "Failed to get dates", http.StatusInternalServerError)
+		return
+	}
+
 	// Return JSON response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(dates)
@@ -82,7 +101,31 @@ Responses:
 				"date_end": "<date_end> ISO 8601 format",
 				"status": <"pending", "confirmed", "rejected">
 			}
-	    400 BAD REQUEST: Returns an error message if the request body is malformed or required fields are missing.
+	    400 BAD REQUEST: Returns an error message if the request body is malformed, required fields are missing, or user2_id is the current user.
+	    403 FORBIDDEN: Either user blocked the other:
+			{
+				"error": "blocked",
+				"message": "Dates cannot be proposed to this user",
+				"user_id": <the other user ID>
+			}
+		or REQUIRE_MUTUAL_LIKE_FOR_DATES is on, and the users have not liked each other:
+			{
+				"error": "not_mutual",
+				"message": "Dates can only be proposed to users who liked you back",
+				"user_id": <the other user ID>
+			}
+	    409 CONFLICT: The date overlaps with a pending or confirmed date of either user:
+			{
+				"error": "overlap_detected",
+				"message": "Date overlaps with an existing date",
+				"conflict": <the conflicting date object>
+			}
+		or the date is outside of either user's availability (weekly availability in that user's time_zone, with their availability exceptions applied):
+			{
+				"error": "outside_availability",
+				"message": "Date is outside of a participant's availability",
+				"user_id": <ID of the user who is not available>
+			}
 */
 func PostDateHandler(w http.ResponseWriter, r *http.Request) {
 	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
@@ -103,9 +146,25 @@ func PostDateHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
+	if date.User2ID == userID {
+		log.Printf("Invalid user2_id provided: %s\n", date.User2ID)
+		http.Error(w, "Invalid user2_id provided", http.StatusBadRequest)
+		return
+	}
 
 	date.User1ID = userID
-	date.Status = "pending" // New dates start as pending
+	date.Status = models.StatusPending // New dates start as pending
+
+	// blocked users cannot date, and when the server requires it, only users who liked each other can
+	if !CheckNotBlocked(w, date, userID, db) || !CheckMutualLike(w, date, db) {
+		return
+	}
+
+	// make sure neither user is double booked, and both are available
+	statuses := []string{models.StatusPending, models.StatusConfirmed}
+	if !CheckDateOverlap(w, date, statuses, db) || !CheckDateAvailability(w, date, db) {
+		return
+	}
 
 	// insert the scheduled date
 	id, err := models.PostDate(date, db)
@@ -121,18 +180,28 @@ func PostDateHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 /*
-PATCH /api/v1/dates: Update a date's status.
+PATCH /api/v1/dates: Update a date's status. Only a participant of the date can change it, following the date lifecycle:
+
+	pending -> confirmed: invitee (user2_id) only
+	pending -> rejected:  invitee (user2_id) only
+	pending -> withdrawn: proposer (user1_id) only
+	pending -> expired:   the server only, once the date started or stayed pending for too long
+	rejected, withdrawn and expired dates can never change status again
+	confirmed dates are cancelled or rescheduled through POST /api/v1/dates/{dateId}/cancel and /reschedule
+
+While a round of proposed slots is open, whoever sent that round acts as the proposer and the other user as the invitee (see POST /api/v1/dates/{dateId}/proposals).
+Rejecting or withdrawing the date closes its open round.
 
 Request Body:
 
 	{
 		"id" = valid date ID
-		"status" = "pending", "confirmed", "rejected"
+		"status" = "confirmed", "rejected", "withdrawn"
 	}
 
 Example:
 
-	PATCH `/api/v1/dates/1/confirmed` would confirm date with ID 1
+	PATCH `/api/v1/dates` with {"id": 1, "status": "confirmed"} would confirm date with ID 1
 
 Returns:
 
@@ -143,13 +212,26 @@ Returns:
 			"user2_id": <other user id > STRING,
 			"date_start": "<date_start> ISO 8601 format",
 			"date_end": "<date_end> ISO 8601 format",
-			"status": <"pending", "confirmed", "rejected">
+			"status": <"pending", "confirmed", "rejected", "withdrawn">
+		}
+	400 BAD REQUEST: Returns an error message if the request is invalid (e.g., invalid matchId format, or "cancelled"/"rescheduled" as status).
+	403 FORBIDDEN: The current user is not a participant, or their role cannot make this change:
+		{
+			"error": <"not_participant" or "forbidden_transition">,
+			"message": <description of the problem>,
+			"from": <current status of the date>,
+			"to": <requested status>
 		}
+		When confirming, also returned if either user blocked the other (same body as POST /api/v1/dates).
+	404 NOT FOUND: No date with the provided id exists.
+	409 CONFLICT: The date cannot move from its current status to the requested one. Same body as 403, with "error": "illegal_transition".
+		When confirming, also returned if either user already has a confirmed date at the same time (same body as the "overlap_detected" response of POST /api/v1/dates),
+		or if the date was proposed with several slots and one of them has to be accepted instead ("error": "negotiation_open").
 	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
-	400 BAD REQUEST: Returns an error message if the request is invalid (e.g., invalid matchId format).
 */
 func PatchDateHandler(w http.ResponseWriter, r *http.Request) {
 	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
 
 	// Parse JSON from the request body
 	var date models.Date
@@ -168,11 +250,54 @@ func PatchDateHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid status provided", http.StatusBadRequest)
 		return
 	}
+	if date.Status == models.StatusCancelled || date.Status == models.StatusRescheduled {
+		// these need a reason, and rescheduling needs a new time
+		log.Printf("Refusing to %s date through PATCH\n", date.Status)
+		http.Error(w, "Use POST /api/v1/dates/{dateId}/cancel or /reschedule instead", http.StatusBadRequest)
+		return
+	}
+
+	currentDate, err := models.GetDate(date.ID, db)
+	if err != nil {
+		log.Printf("Failed to retrieve date: %v\n", err)
+		if errors.Is(err, models.ErrDateNotFound) {
+			http.Error(w, "Date not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Retrieving date failed", http.StatusInternalServerError)
+		return
+	}
+
+	if date.Status == models.StatusConfirmed {
+		// dates proposed with several slots are confirmed by accepting one of the slots
+		_, err := models.GetOpenProposal(currentDate.ID, db)
+		if err == nil {
+			log.Printf("Refusing to confirm date %d with an open proposal\n", currentDate.ID)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":   "negotiation_open",
+				"message": "Accept one of the proposed slots instead",
+			})
+			return
+		} else if !errors.Is(err, models.ErrNoOpenProposal) {
+			log.Printf("Failed to check for open proposals: %v\n", err)
+			http.Error(w, "Updating status failed", http.StatusInternalServerError)
+			return
+		}
+
+		// a date can only be confirmed if neither user blocked the other since it was proposed,
+		// and neither user has another confirmed date at the same time
+		if !CheckNotBlocked(w, *currentDate, userID, db) || !CheckDateOverlap(w, *currentDate, []string{models.StatusConfirmed}, db) {
+			return
+		}
+	}
 
-	err := models.PatchDate(date.ID, date.Status, db)
+	// check the transition table, then update
+	err = models.TransitionDate(currentDate, userID, date.Status, db)
 	if err != nil {
 		log.Printf("Error updating date status: %v\n", err)
-		http.Error(w, "Updating status failed", http.StatusInternalServerError)
+		WriteTransitionError(w, err)
 		return
 	}
 
@@ -189,6 +314,8 @@ func PatchDateHandler(w http.ResponseWriter, r *http.Request) {
 
 /*
 DELETE /api/v1/dates/{dateId}: Deletes a date based on the request parameter dateId.
+The proposer (user1_id, or whoever sent the open round of proposed slots) can delete a pending date (withdrawing it), and either participant can delete a rejected, withdrawn or expired date.
+Confirmed dates cannot be deleted, and cancelled or rescheduled dates are kept as history.
 
 Request URL Parameter:
 
@@ -198,10 +325,14 @@ Returns:
 
 	204 No Content: Indicates the date was successfully deleted.
 	400 Bad Request: Returned if the date ID is not valid or cannot be converted to an integer.
+	403 Forbidden: Returned if the current user is not a participant, or is not the proposer of a pending date (same body as PATCH /api/v1/dates).
+	404 Not Found: Returned if no date with dateId exists.
+	409 Conflict: Returned if the date is confirmed, cancelled or rescheduled and cannot be deleted (same body as PATCH /api/v1/dates).
 	500 Internal Server Error: Returned if there is an error deleting the date or querying the database.
 */
 func DeleteDateHandler(w http.ResponseWriter, r *http.Request) {
-	db := r.Context().Value("db").(*sql.DB)
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
 
 	// get the date ID from the route parameters
 	vars := mux.Vars(r)
@@ -210,11 +341,35 @@ func DeleteDateHandler(w http.ResponseWriter, r *http.Request) {
 	// convert into int
 	dateID, err := strconv.Atoi(dateIDStr)
 	if err != nil {
-		log.Printf("Invalid date ID: %d\n", dateID)
+		log.Printf("Invalid date ID: %s\n", dateIDStr)
 		http.Error(w, "Invalid date ID", http.StatusBadRequest)
 		return
 	}
 
+	date, err := models.GetDate(dateID, db)
+	if err != nil {
+		log.Printf("Failed to retrieve date: %v\n", err)
+		if errors.Is(err, models.ErrDateNotFound) {
+			http.Error(w, "Date not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error deleting date", http.StatusInternalServerError)
+		return
+	}
+
+	// make sure the current user is allowed to delete this date, as whoever sent the open round if there is one
+	open, err := models.GetOpenProposal(dateID, db)
+	if err != nil && !errors.Is(err, models.ErrNoOpenProposal) {
+		log.Printf("Failed to check for open proposals: %v\n", err)
+		http.Error(w, "Error deleting date", http.StatusInternalServerError)
+		return
+	}
+	if err := models.CheckDateDeletion(date, open, userID); err != nil {
+		log.Printf("Refusing to delete date %d: %v\n", dateID, err)
+		WriteTransitionError(w, err)
+		return
+	}
+
 	// Call the function to delete the date.
 	err = models.DeleteDate(dateID, db)
 	if err != nil {
@@ -227,6 +382,170 @@ func DeleteDateHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+/*
+POST /api/v1/dates/{dateId}/cancel: Cancels a confirmed date. Either participant can cancel; the date is kept with status "cancelled",
+along with who cancelled it and why, and the cancelling user's cancellation count goes up.
+
+Request Body:
+
+	{
+		"reason": <why the date is cancelled> STRING
+	}
+
+Returns:
+
+	200 OK: Return the cancelled date
+		{
+			"id": <unique id> INT,
+			"user1_id": STRING,
+			"user2_id": STRING,
+			"date_start": "<date_start> ISO 8601 format",
+			"date_end": "<date_end> ISO 8601 format",
+			"status": "cancelled",
+			"created_at": STRING,
+			"cancelled_by": <current user id> STRING,
+			"cancel_reason": <provided reason> STRING,
+			"cancelled_at": <when the date was cancelled> STRING
+		}
+	400 BAD REQUEST: the request body is malformed, or no reason was provided
+	403 FORBIDDEN: the current user is not a participant (same body as PATCH /api/v1/dates)
+	404 NOT FOUND: no date with dateId exists
+	409 CONFLICT: the date is not confirmed (same body as PATCH /api/v1/dates)
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func CancelDateHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	date, ok := GetRequestedDate(w, r, db)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Invalid request body: %v\n", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(request.Reason) == "" {
+		log.Println("No reason provided for cancelling date")
+		http.Error(w, "A reason is required", http.StatusBadRequest)
+		return
+	}
+
+	err := models.CancelDate(date, userID, request.Reason, db)
+	if err != nil {
+		log.Printf("Error cancelling date %d: %v\n", date.ID, err)
+		WriteTransitionError(w, err)
+		return
+	}
+
+	cancelledDate, err := models.GetDate(date.ID, db)
+	if err != nil {
+		log.Printf("Failed to retrieve cancelled date: %v\n", err)
+		http.Error(w, "Retrieving cancelled date failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cancelledDate)
+}
+
+/*
+POST /api/v1/dates/{dateId}/reschedule: Moves a confirmed date to a new time. Either participant can reschedule; the original date is kept with
+status "rescheduled" (along with who rescheduled it and why), and a new pending date is proposed to the other participant at the new time.
+
+Request Body:
+
+	{
+		"reason": <why the date is rescheduled> STRING,
+		"date_start": "<new start> ISO 8601 format",
+		"date_end": "<new end> ISO 8601 format"
+	}
+
+Returns:
+
+	200 OK: Return the original and the new date
+		{
+			"original": <the original date, same format as POST /api/v1/dates/{dateId}/cancel with "status": "rescheduled">,
+			"rescheduled": <the new pending date, with "rescheduled_from": <id of the original date>>
+		}
+	400 BAD REQUEST: the request body is malformed, no reason was provided, or the new times are invalid
+	403 FORBIDDEN: the current user is not a participant (same body as PATCH /api/v1/dates), or either user blocked the other (same body as POST /api/v1/dates)
+	404 NOT FOUND: no date with dateId exists
+	409 CONFLICT: the date is not confirmed (same body as PATCH /api/v1/dates), or the new time overlaps with another date
+		of either user or is outside of their availability (same bodies as POST /api/v1/dates)
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func RescheduleDateHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	date, ok := GetRequestedDate(w, r, db)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Reason    string `json:"reason"`
+		DateStart string `json:"date_start"`
+		DateEnd   string `json:"date_end"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Invalid request body: %v\n", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(request.Reason) == "" {
+		log.Println("No reason provided for rescheduling date")
+		http.Error(w, "A reason is required", http.StatusBadRequest)
+		return
+	}
+
+	// check the new time like a new date, ignoring the date it replaces
+	newDate := *date
+	newDate.DateStart = request.DateStart
+	newDate.DateEnd = request.DateEnd
+	if err := ValidateIsoTimestamp(newDate); err != nil {
+		log.Printf("Invalid new time provided: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	statuses := []string{models.StatusPending, models.StatusConfirmed}
+	if !CheckNotBlocked(w, newDate, userID, db) || !CheckDateOverlap(w, newDate, statuses, db) || !CheckDateAvailability(w, newDate, db) {
+		return
+	}
+
+	newID, err := models.RescheduleDate(date, userID, request.Reason, request.DateStart, request.DateEnd, db)
+	if err != nil {
+		log.Printf("Error rescheduling date %d: %v\n", date.ID, err)
+		WriteTransitionError(w, err)
+		return
+	}
+
+	original, err := models.GetDate(date.ID, db)
+	if err != nil {
+		log.Printf("Failed to retrieve rescheduled date: %v\n", err)
+		http.Error(w, "Retrieving rescheduled date failed", http.StatusInternalServerError)
+		return
+	}
+	rescheduled, err := models.GetDate(newID, db)
+	if err != nil {
+		log.Printf("Failed to retrieve new date: %v\n", err)
+		http.Error(w, "Retrieving new date failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"original":    original,
+		"rescheduled": rescheduled,
+	})
+}
+
 // HELPER FUNC: Make sure date_start and date_end are valid ISO 8601 format
 func ValidateIsoTimestamp(date models.Date) error {
 	// Parse times to ensure start_time < end_time
@@ -246,3 +565,84 @@ func ValidateIsoTimestamp(date models.Date) error {
 
 	return nil
 }
+
+// HELPER FUNC: Respond to a refused date status change with a 403 or 409 and a JSON body describing the problem
+func WriteTransitionError(w http.ResponseWriter, err error) {
+	var transitionErr *models.TransitionError
+	if !errors.As(err, &transitionErr) {
+		http.Error(w, "Updating status failed", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusConflict
+	code := "illegal_transition"
+	switch {
+	case errors.Is(err, models.ErrNotParticipant):
+		status = http.StatusForbidden
+		code = "not_participant"
+	case errors.Is(err, models.ErrForbiddenTransition):
+		status = http.StatusForbidden
+		code = "forbidden_transition"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":   code,
+		"message": transitionErr.Err.Error(),
+		"from":    transitionErr.From,
+		"to":      transitionErr.To,
+	})
+}
+
+// HELPER FUNC: Respond with a 409 if the date overlaps with another date of either participant with one of the given statuses. Returns false if a response was written.
+func CheckDateOverlap(w http.ResponseWriter, date models.Date, statuses []string, db *sql.DB) bool {
+	users := []string{date.User1ID, date.User2ID}
+	conflict, err := models.GetConflictingDate(users, date.DateStart, date.DateEnd, statuses, date.ID, db)
+	if err != nil {
+		log.Printf("Error checking for overlapping dates: %v\n", err)
+		http.Error(w, "Failed to check overlap", http.StatusInternalServerError)
+		return false
+	}
+	if conflict != nil {
+		// Conflict detected, respond with conflict details
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    "overlap_detected",
+			"message":  "Date overlaps with an existing date",
+			"conflict": conflict, // Include the conflicting date
+		})
+		return false
+	}
+	return true
+}
+
+// HELPER FUNC: Respond with a 409 if either participant is not available for the whole date, going by their weekly availability in their own time zone and their availability exceptions. Returns false if a response was written.
+func CheckDateAvailability(w http.ResponseWriter, date models.Date, db *sql.DB) bool {
+	// timestamps were already validated by ValidateIsoTimestamp
+	start, _ := time.Parse(time.RFC3339, date.DateStart)
+	end, _ := time.Parse(time.RFC3339, date.DateEnd)
+
+	for _, userID := range []string{date.User1ID, date.User2ID} {
+		slots, err := models.GetConcreteAvailability(userID, start, end, db)
+		if err != nil {
+			log.Printf("Error checking availability for date: %v\n", err)
+			http.Error(w, "Failed to check availability", http.StatusInternalServerError)
+			return false
+		}
+
+		// slots are cut to the date, so a single slot covering all of it means the user is free
+		if len(slots) != 1 || !slots[0].Start.Equal(start) || !slots[0].End.Equal(end) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":   "outside_availability",
+				"message": "Date is outside of a participant's availability",
+				"user_id": userID,
+			})
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"go-react-backend/contextkeys"
+	"go-react-backend/models"
+	"log"
+	"net/http"
+	"time"
+)
+
+/*
+POST /api/v1/dates/{dateId}/feedback: Leave feedback for a confirmed date once it has ended. Each participant can leave feedback once.
+
+Request Body:
+
+	{
+		"rating": <1 to 5> INT,
+		"would_meet_again": <whether you would go on another date with them> BOOL,
+		"notes": <private notes, never shown to the other user> STRING (optional)
+	}
+
+Returns:
+
+	200 OK: Returns the stored feedback
+		{
+			"id": <unique feedback id> INT,
+			"date_id": <id of the date> INT,
+			"user_id": <current user id> STRING,
+			"rating": <1 to 5> INT,
+			"would_meet_again": BOOL,
+			"notes": STRING
+		}
+	400 BAD REQUEST: the request body is malformed, or the rating is not between 1 and 5
+	403 FORBIDDEN: the current user is not a participant of the date
+	404 NOT FOUND: no date with dateId exists
+	409 CONFLICT: the date is not confirmed, has not ended yet, or the current user already left feedback
+		{
+			"error": <"date_not_confirmed", "date_not_ended" or "feedback_exists">,
+			"message": <description of the problem>
+		}
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func PostDateFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	date, ok := GetRequestedDate(w, r, db)
+	if !ok {
+		return
+	}
+
+	var feedback models.Feedback
+	if err := json.NewDecoder(r.Body).Decode(&feedback); err != nil {
+		log.Printf("Invalid request body: %v\n", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if feedback.Rating < 1 || feedback.Rating > 5 {
+		log.Printf("Invalid rating provided: %d\n", feedback.Rating)
+		http.Error(w, "Rating must be between 1 and 5", http.StatusBadRequest)
+		return
+	}
+	feedback.DateID = date.ID
+	feedback.UserID = userID
+
+	id, err := models.PostFeedback(date, feedback, time.Now(), db)
+	if err != nil {
+		log.Printf("Failed to leave feedback for date %d: %v\n", date.ID, err)
+
+		var code string
+		switch {
+		case errors.Is(err, models.ErrNotParticipant):
+			http.Error(w, "Not a participant of this date", http.StatusForbidden)
+			return
+		case errors.Is(err, models.ErrDateNotConfirmed):
+			code = "date_not_confirmed"
+		case errors.Is(err, models.ErrDateNotEnded):
+			code = "date_not_ended"
+		case errors.Is(err, models.ErrFeedbackExists):
+			code = "feedback_exists"
+		default:
+			http.Error(w, "Failed to leave feedback", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":   code,
+			"message": err.Error(),
+		})
+		return
+	}
+	feedback.ID = id
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(feedback)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"go-react-backend/contextkeys"
+	"go-react-backend/models"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+/*
+POST /api/v1/matches/{userId}/like, POST /api/v1/matches/{userId}/pass: Likes or passes on another user. A new action replaces the previous one.
+Passed pairs are never matched again, in either direction. Liking is private until the other user likes back, which makes the match mutual.
+
+Returns:
+
+	200 OK:
+		{
+			"user_id": <the other user ID> STRING,
+			"action": <"like" or "pass"> STRING,
+			"mutual": <true if both users now like each other> BOOL
+		}
+	400 BAD REQUEST: the current user acted on themselves
+	404 NOT FOUND: no user with userId exists
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func PostMatchActionHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	vars := mux.Vars(r)
+	targetID := vars["userId"]
+	action := vars["action"] // the route only allows like and pass
+
+	if targetID == userID {
+		log.Printf("User tried to %s themselves\n", action)
+		http.Error(w, "Cannot like or pass on yourself", http.StatusBadRequest)
+		return
+	}
+	if !CheckUserExists(w, targetID, db) {
+		return
+	}
+
+	mutual, err := models.RecordMatchAction(userID, targetID, action, db)
+	if err != nil {
+		log.Printf("Failed to record match action: %v\n", err)
+		http.Error(w, "Failed to record match action", http.StatusInternalServerError)
+		return
+	}
+
+	// a pass removes the pair from both stored match lists, which may now have room for another user
+	if action == models.ActionPass {
+		QueueMatchUpdate(r, userID)
+		QueueMatchUpdate(r, targetID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user_id": targetID,
+		"action":  action,
+		"mutual":  mutual,
+	})
+}
+
+// HELPER FUNC: When REQUIRE_MUTUAL_LIKE_FOR_DATES is on, make sure both users of date liked each other. Returns false if an error response was written.
+func CheckMutualLike(w http.ResponseWriter, date models.Date, db *sql.DB) bool {
+	if !models.MutualLikeRequiredForDates() {
+		return true
+	}
+
+	mutual, err := models.IsMutualLike(date.User1ID, date.User2ID, db)
+	if err != nil {
+		log.Printf("Failed to check mutual like: %v\n", err)
+		http.Error(w, "Failed to check mutual like", http.StatusInternalServerError)
+		return false
+	}
+	if !mutual {
+		log.Printf("Users %s and %s have not liked each other\n", date.User1ID, date.User2ID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":   "not_mutual",
+			"message": "Dates can only be proposed to users who liked you back",
+			"user_id": date.User2ID,
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"go-react-backend/contextkeys"
+	"go-react-backend/models"
+	"log"
+	"net/http"
+)
+
+// range of class years accepted in profiles and filters
+const (
+	MIN_CLASS_YEAR = 1950
+	MAX_CLASS_YEAR = 2100
+)
+
+/*
+GET /api/v1/users/me/filters: Gets the dealbreaker filters of the current user. Gender filters are set through "seeking" on PATCH /api/v1/users.
+
+Returns:
+
+	200 OK:
+		{
+			"min_age": <youngest age to match with, null for no limit> INT,
+			"max_age": <oldest age to match with, null for no limit> INT,
+			"min_class_year": <earliest class year to match with, null for no limit> INT,
+			"max_class_year": <latest class year to match with, null for no limit> INT
+		}
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func GetMatchFiltersHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	filters, err := models.GetMatchFilters(userID, db)
+	if err != nil {
+		log.Printf("Failed to get match filters: %v\n", err)
+		http.Error(w, "Failed to get match filters", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(filters)
+}
+
+/*
+PUT /api/v1/users/me/filters: Replaces the dealbreaker filters of the current user.
+Filters are mutual: two users are only matched if each one's gender is in the other's "seeking", and each one's age and class year pass the other's filters.
+Users who did not give a birth_date or class_year never pass an age or class year limit.
+
+Request Body: (a missing or null field means no limit)
+
+	{
+		"min_age": <youngest age to match with, at least 18> INT,
+		"max_age": <oldest age to match with> INT,
+		"min_class_year": <earliest class year to match with> INT,
+		"max_class_year": <latest class year to match with> INT
+	}
+
+Returns:
+
+	200 OK: Returns the new filters, in the same format as GET /api/v1/users/me/filters
+	400 BAD REQUEST: the request body is malformed, or a limit is out of range
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func PutMatchFiltersHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	var filters models.MatchFilters
+	if err := json.NewDecoder(r.Body).Decode(&filters); err != nil {
+		log.Printf("Invalid request body: %v\n", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := ValidateMatchFilters(filters); err != nil {
+		log.Printf("Invalid match filters provided: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := models.PutMatchFilters(userID, filters, db); err != nil {
+		log.Printf("Failed to update match filters: %v\n", err)
+		http.Error(w, "Failed to update match filters", http.StatusInternalServerError)
+		return
+	}
+
+	// the filters decide who can be matched at all
+	QueueMatchUpdate(r, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(filters)
+}
+
+// HELPER FUNC: Check that every limit is in range, and that no minimum is above its maximum
+func ValidateMatchFilters(filters models.MatchFilters) error {
+	if filters.MinAge != nil && *filters.MinAge < models.MIN_AGE {
+		return errors.New("invalid min_age; must be at least 18")
+	}
+	if filters.MaxAge != nil && *filters.MaxAge < models.MIN_AGE {
+		return errors.New("invalid max_age; must be at least 18")
+	}
+	if filters.MinAge != nil && filters.MaxAge != nil && *filters.MinAge > *filters.MaxAge {
+		return errors.New("invalid age filter; min_age is above max_age")
+	}
+
+	for _, year := range []*int{filters.MinClassYear, filters.MaxClassYear} {
+		if year != nil && (*year < MIN_CLASS_YEAR || *year > MAX_CLASS_YEAR) {
+			return errors.New("invalid class year filter; must be between 1950 and 2100")
+		}
+	}
+	if filters.MinClassYear != nil && filters.MaxClassYear != nil && *filters.MinClassYear > *filters.MaxClassYear {
+		return errors.New("invalid class year filter; min_class_year is above max_class_year")
+	}
+	return nil
+}
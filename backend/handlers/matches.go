@@ -3,51 +3,98 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"go-react-backend/contextkeys"
 	"go-react-backend/models"
+	"go-react-backend/workers"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
 )
 
+// most weeks ahead GET /api/v1/matches?concrete=true can list upcoming slots for
+const MAX_UPCOMING_WEEKS = 8
+
+// most matches GET /api/v1/matches returns at once
+const MAX_MATCHES_PAGE = 100
+
 /*
 GET /api/v1/matches: find the top matches for a user.
 
 Returns a list of Matches: each match corresponds to another user.
 Each match has a sublist of availability timeslots, where both the current user and that user are available.
-The list is sorted by the similarity score between [current user] and [other user].
+Overlaps are computed across time zones, and rendered in the current user's time_zone (or the zone given with "tz").
+Overlaps are cut to the stricter min_date_minutes and slot_granularity_minutes of both users, and users whose overlaps are all too short are not matches.
+Both default to 30 minutes, so overlaps shorter than 30 minutes are never offered, even to users who did not set either preference.
+Users who are not free at any concrete time in the next 2 weeks (e.g. because of a blackout exception) are not matches.
+Users the current user passed on, or who passed on the current user, are not matches. "liked" and "mutual" show whether the current user liked the match, and whether they liked each other.
+
+The top 50 matches are served from the matches table, which is recomputed in the background after the current user changes their availability,
+quiz answers, profile or filters (see GET /api/v1/matches/status), and updated when another user's changes affect their pair. Pages past the top 50 are computed on request.
+Reading matches that were never stored, or were last rebuilt more than a day ago, rebuilds them in the background.
+
+Matches are paged with a cursor: pass the "next_cursor" of a page as "cursor" to get the page after it. Pages never repeat or skip a match whose score did not change.
+
+With concrete=true, each match also lists "upcoming_slots": the concrete times in the next "weeks" weeks when both users are free,
+with availability exceptions applied and without the time either user already spends on a pending or confirmed date.
+A slot can be sent as is to POST /api/v1/dates (together with "user2_id").
+With explain=true, each match also has an "explanation" of its score, as returned by GET /api/v1/matches/{userId}/explain.
+The list is sorted by the similarity score between [current user] and [other user], ties by the other user's id.
 
 Request Params:
 
-	count: number of matches to return
-	offset: offset from beginning of matches list to return from
+	count: number of matches to return, 1 to 100 (default: 10)
+	cursor: "next_cursor" of the previous page (default: start from the best match)
+	tz: IANA time zone to render the availabilities in (default: the current user's time_zone)
+	concrete: "true" to add the "upcoming_slots" of every match (default: false)
+	weeks: how many weeks ahead to list upcoming slots for, 1 to 8 (default: 2, only used with concrete=true)
+	explain: "true" to add the "explanation" of every match (default: false)
 
 > Example:
-> count = 20 and offset = 10,
-> `GET /api/v1/matches?count=20&offset=10` returns the 10th to 30th overlapping availability to the current user, sorted by similarity.
+> `GET /api/v1/matches?count=20` returns the 20 best matches of the current user, and
+> `GET /api/v1/matches?count=20&cursor=<next_cursor>` the 20 after them.
+> Right after a change the list can still show the previous matches, until the recompute is done. The list of a new user is empty until their first recompute is done.
 
 Returns:
 
-	200 OK: Returns a list of matches
-	[
-		{ // FIRST MATCH ENTRY
-			"user1_id": "afd37871-3445-4162-9de0-8e3bfd144b98",
-			"user2_id": "9e2d0dec-fec2-4cab-b742-bad2ea343490",
-			"similarity_score": 1,
-			"availabilities": [
-				{ // LIST OF AVAILABILITIES
-					"id": 0,
-					"user_id": "9e2d0dec-fec2-4cab-b742-bad2ea343490",
-					"start_time": "11:30",
-					"end_time": "12:00",
-					"day_of_week": "Monday"
-				},
-				...
-			]
-		},
-		... // MORE MATCH ENTRIES
-	]
+	200 OK: Returns a page of matches
+	{
+		"matches": [
+			{ // FIRST MATCH ENTRY
+				"user1_id": "afd37871-3445-4162-9de0-8e3bfd144b98",
+				"user2_id": "9e2d0dec-fec2-4cab-b742-bad2ea343490",
+				"similarity_score": 1,
+				"liked": <the current user liked this user> BOOL,
+				"mutual": <both users liked each other> BOOL,
+				"availabilities": [
+					{ // LIST OF AVAILABILITIES
+						"id": 0,
+						"user_id": "9e2d0dec-fec2-4cab-b742-bad2ea343490",
+						"start_time": "11:30",
+						"end_time": "12:00",
+						"day_of_week": "Monday"
+					},
+					...
+				],
+				"upcoming_slots": [ // ONLY WITH concrete=true
+					{
+						"date_start": "2026-10-19T11:30:00-07:00",
+						"date_end": "2026-10-19T12:00:00-07:00"
+					},
+					...
+				],
+				"explanation": { ... } // ONLY WITH explain=true, see GET /api/v1/matches/{userId}/explain
+			},
+			... // MORE MATCH ENTRIES
+		],
+		"next_cursor": <pass as cursor to get the next page, null on the last page> STRING,
+		"total": <how many matches the current user has> INT
+	}
+	400 BAD REQUEST: Returns an error message if a request param is invalid, e.g. a cursor that was not returned as "next_cursor".
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
 */
 func GetMatchesHandler(w http.ResponseWriter, r *http.Request) {
 	// get db and userID from context
@@ -56,90 +103,330 @@ func GetMatchesHandler(w http.ResponseWriter, r *http.Request) {
 
 	// request params
 	countParam := r.URL.Query().Get("count")   // 'count' parameter
-	offsetParam := r.URL.Query().Get("offset") // 'offset' parameter
+	cursorParam := r.URL.Query().Get("cursor") // 'cursor' parameter
+
+	concreteParam := r.URL.Query().Get("concrete") // 'concrete' parameter
+	weeksParam := r.URL.Query().Get("weeks")       // 'weeks' parameter
+	explainParam := r.URL.Query().Get("explain")   // 'explain' parameter
 
 	// Default values
 	count := 10
-	offset := 0
+	var cursor *models.MatchCursor
+	concrete := false
+	weeks := models.UPCOMING_WEEKS
+	explain := false
+
+	// zone to render the availabilities in
+	viewerLoc, err := ViewerLocation(r, userID, db)
+	if err != nil {
+		log.Printf("Error getting viewer's time zone: %v\n", err)
+		if errors.Is(err, models.ErrInvalidTimeZone) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Error getting time zone", http.StatusInternalServerError)
+		return
+	}
 
 	// Parse and validate the count parameter
 	if countParam != "" {
-		var err error
 		count, err = strconv.Atoi(countParam)
-		if err != nil || count <= 0 {
+		if err != nil || count <= 0 || count > MAX_MATCHES_PAGE {
 			log.Printf("Invalid count provided (%d): %v\n", count, err)
 			http.Error(w, "Invalid count parameter", http.StatusBadRequest)
 			return
 		}
 	}
 
-	// Parse and validate the offset parameter
-	if offsetParam != "" {
-		var err error
-		offset, err = strconv.Atoi(offsetParam)
-		if err != nil || offset < 0 {
-			log.Printf("Invalid offset provided (%d): %v\n", offset, err)
-			http.Error(w, "Invalid offset parameter", http.StatusBadRequest)
+	// Parse and validate the cursor parameter
+	if cursorParam != "" {
+		parsed, err := models.ParseMatchCursor(cursorParam)
+		if err != nil {
+			log.Printf("Invalid cursor provided (%s): %v\n", cursorParam, err)
+			http.Error(w, "Invalid cursor parameter", http.StatusBadRequest)
 			return
 		}
+		cursor = &parsed
 	}
 
-	var matches []models.UserMatches
-	var err error
-
-	if offset+count <= 50 {
-		// If offset + count < 50 matches: call models.GetMatches to get matches from our table
-		matches, err = models.GetMatches(userID, db)
+	// Parse and validate the concrete and weeks parameters
+	if concreteParam != "" {
+		concrete, err = strconv.ParseBool(concreteParam)
 		if err != nil {
-			log.Printf("Error retrieving matches: %v\n", err)
-			http.Error(w, "Error getting matches", http.StatusInternalServerError)
+			log.Printf("Invalid concrete provided (%s): %v\n", concreteParam, err)
+			http.Error(w, "Invalid concrete parameter", http.StatusBadRequest)
 			return
 		}
 	}
-	if len(matches) < 50 {
-		// update matches table if it looks too empty
-		err = models.UpdateMatches(userID, db)
+	if weeksParam != "" {
+		weeks, err = strconv.Atoi(weeksParam)
+		if err != nil || weeks < 1 || weeks > MAX_UPCOMING_WEEKS {
+			log.Printf("Invalid weeks provided (%d): %v\n", weeks, err)
+			http.Error(w, "Invalid weeks parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	if explainParam != "" {
+		explain, err = strconv.ParseBool(explainParam)
 		if err != nil {
-			log.Printf("Error updating matches: %v\n", err)
-			http.Error(w, "Error updating matches", http.StatusInternalServerError)
+			log.Printf("Invalid explain provided (%s): %v\n", explainParam, err)
+			http.Error(w, "Invalid explain parameter", http.StatusBadRequest)
 			return
 		}
 	}
-	if offset+count > 50 || len(matches) < 50 {
-		// If offset + count > 50 or if querying GetMatches didn't return enough matches: compute matches manually
+
+	// the top matches are served from the matches table, which the match queue keeps up to date
+	matches, total, stored, err := models.GetStoredMatches(userID, db)
+	if err != nil {
+		log.Printf("Error retrieving matches: %v\n", err)
+		http.Error(w, "Error getting matches", http.StatusInternalServerError)
+		return
+	}
+
+	// rebuild the user's own stored matches if they were never stored or are too old. A read changes nothing, so the other users' matches are left alone
+	queue, hasQueue := r.Context().Value(contextkeys.MatchQueueContextKey).(*workers.MatchQueue)
+	if hasQueue {
+		stale, err := models.StoredMatchesStale(userID, db)
+		if err != nil {
+			log.Printf("Error checking whether matches are stale: %v\n", err)
+		} else if stale {
+			queue.EnqueueRefresh(userID)
+		}
+	}
+
+	// the stored matches are the top of the full list, so they can serve any page that ends inside them
+	complete := stored && len(matches) >= total
+	if !stored && hasQueue {
+		// the match queue is computing them, see GET /api/v1/matches/status
+		complete = true
+	} else if !complete && len(models.MatchesAfter(matches, cursor)) < count {
+		// past the top matches: compute matches manually
 		matches, err = models.ComputeMatches(userID, db)
 		if err != nil {
 			log.Printf("Error computing new matches: %v\n", err)
 			http.Error(w, "Error computing matches", http.StatusInternalServerError)
 			return
 		}
+		total = len(matches)
+		complete = true
 	}
 
-	// Get an appropriate subset of matches
-	matchesSlice, err := PaginateMatches(matches, count, offset)
+	// Get the page after the cursor
+	matchesSlice, more := PaginateMatches(matches, count, cursor)
+	more = more || !complete
+	var nextCursor *string
+	if more && len(matchesSlice) > 0 {
+		encoded := models.CursorOf(matchesSlice[len(matchesSlice)-1]).Encode()
+		nextCursor = &encoded
+	}
+
+	// likes of the current user, and whether they are mutual
+	err = models.AttachMatchActions(matchesSlice, userID, db)
 	if err != nil {
-		log.Printf("Error getting a subset of matches to return: %v\n", err)
-		http.Error(w, "Error getting a subset of matches: invalid offset.", http.StatusBadRequest)
+		log.Printf("Error getting match actions: %v\n", err)
+		http.Error(w, "Error getting match actions", http.StatusInternalServerError)
 		return
 	}
 
+	// concrete upcoming slots, only if asked for
+	for i := range matchesSlice {
+		matchesSlice[i].UpcomingSlots = nil
+	}
+	if concrete {
+		now := time.Now()
+		err = models.AttachUpcomingSlots(matchesSlice, userID, now, now.AddDate(0, 0, 7*weeks), db)
+		if err != nil {
+			log.Printf("Error getting upcoming slots: %v\n", err)
+			http.Error(w, "Error getting upcoming slots", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// score breakdowns, only if asked for
+	if explain {
+		err = models.AttachMatchExplanations(matchesSlice, userID, db)
+		if err != nil {
+			log.Printf("Error explaining matches: %v\n", err)
+			http.Error(w, "Error explaining matches", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// matches store overlaps in UTC
+	for i := range matchesSlice {
+		matchesSlice[i].Availabilities = models.MergeAvailability(matchesSlice[i].Availabilities, time.UTC, viewerLoc)
+		for j := range matchesSlice[i].UpcomingSlots {
+			slot := &matchesSlice[i].UpcomingSlots[j]
+			slot.Start, slot.End = slot.Start.In(viewerLoc), slot.End.In(viewerLoc)
+		}
+	}
+
+	if matchesSlice == nil {
+		matchesSlice = []models.UserMatches{}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(matchesSlice)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"matches":     matchesSlice,
+		"next_cursor": nextCursor,
+		"total":       total,
+	})
 }
 
-// HELPER FUNC: returns a subset of matches based on the count and offset.
-func PaginateMatches(matches []models.UserMatches, count, offset int) ([]models.UserMatches, error) {
-	// Validate offset
-	if offset < 0 || offset > len(matches) {
-		return nil, fmt.Errorf("invalid offset: %d", offset)
+// HELPER FUNC: returns the count matches after cursor (sorted by similarity, ties by user id), and whether more matches follow them.
+func PaginateMatches(matches []models.UserMatches, count int, cursor *models.MatchCursor) ([]models.UserMatches, bool) {
+	after := models.MatchesAfter(matches, cursor)
+	if len(after) > count {
+		return after[:count], true
 	}
+	return after, false
+}
+
+/*
+GET /api/v1/matches/{userId}/explain: Explains why the current user was matched with another user, as a breakdown of their similarity score.
+The breakdown is recomputed from the current quiz answers and importance of both users, so "score" can differ from "similarity_score" until the matches are recomputed.
+
+The score is the geometric mean of two satisfactions: how well the other user's answers fit what the current user marked as important, and the other way around.
+Each satisfaction accounts for half of the score, split between the questions by their importance and agreement.
+Questions both users answered at the same end of the scale are shared interests, and their contributions add up to the "shared_interests" factor.
+Availability does not change the score, it only decides who is a match, so its factor is always 0.
 
-	// Calculate the end index for the slice
-	end := offset + count
-	if end > len(matches) {
-		end = len(matches) // Ensure we don't exceed the slice bounds
+Request Params:
+
+	tz: IANA time zone to render the availabilities in (default: the current user's time_zone)
+
+Returns:
+
+	200 OK: Returns the match, as listed by GET /api/v1/matches, with its explanation
+	{
+		"user1_id": <current user ID> STRING,
+		"user2_id": <userId> STRING,
+		"similarity_score": 0.0 to 1.0,
+		"liked": <the current user liked this user> BOOL,
+		"mutual": <both users liked each other> BOOL,
+		"availabilities": [ ... ],
+		"explanation": {
+			"metric": <similarity metric, e.g. "squared"> STRING,
+			"score": <score recomputed from the current answers, the sum of every contribution> FLOAT,
+			"your_satisfaction": <how well their answers fit what the current user finds important, 0.0 to 1.0> FLOAT,
+			"their_satisfaction": <how well the current user's answers fit what they find important, 0.0 to 1.0> FLOAT,
+			"questions": [
+				{
+					"position": <index of the answer in the quiz vector> INT,
+					"prompt": "How much do you like/listen to music?",
+					"your_answer": 5,
+					"their_answer": 4,
+					"your_importance": "very",
+					"their_importance": "a little",
+					"agreement": <1 for the same answer, 0 for opposite ends of the scale> FLOAT,
+					"contribution": <part of the score earned by this question> FLOAT,
+					"shared_interest": <both answered at the same end of the scale> BOOL
+				},
+				...
+			],
+			"shared_interests": ["Can't live without music", ...],
+			"overlap_minutes_per_week": <weekly time both users are available> INT,
+			"factors": [
+				{ "factor": "quiz_agreement", "contribution": FLOAT },
+				{ "factor": "shared_interests", "contribution": FLOAT },
+				{ "factor": "availability", "contribution": 0 }
+			]
+		}
+	}
+	400 BAD REQUEST: Returns an error message if tz is not a valid time zone.
+	404 NOT FOUND: userId is not a match of the current user
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func GetMatchExplanationHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+	targetID := mux.Vars(r)["userId"]
+
+	// zone to render the availabilities in
+	viewerLoc, err := ViewerLocation(r, userID, db)
+	if err != nil {
+		log.Printf("Error getting viewer's time zone: %v\n", err)
+		if errors.Is(err, models.ErrInvalidTimeZone) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Error getting time zone", http.StatusInternalServerError)
+		return
+	}
+
+	match, err := models.GetMatch(userID, targetID, db)
+	if errors.Is(err, models.ErrMatchNotFound) {
+		http.Error(w, "Match not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error retrieving match with %s: %v\n", targetID, err)
+		http.Error(w, "Error getting match", http.StatusInternalServerError)
+		return
+	}
+
+	matches := []models.UserMatches{match}
+	if err := models.AttachMatchActions(matches, userID, db); err != nil {
+		log.Printf("Error getting match actions: %v\n", err)
+		http.Error(w, "Error getting match actions", http.StatusInternalServerError)
+		return
+	}
+	if err := models.AttachMatchExplanations(matches, userID, db); err != nil {
+		log.Printf("Error explaining match with %s: %v\n", targetID, err)
+		http.Error(w, "Error explaining match", http.StatusInternalServerError)
+		return
+	}
+
+	// matches store overlaps in UTC
+	match = matches[0]
+	match.UpcomingSlots = nil
+	match.Availabilities = models.MergeAvailability(match.Availabilities, time.UTC, viewerLoc)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(match)
+}
+
+/*
+GET /api/v1/matches/status: Shows whether the stored matches of the current user are being recomputed.
+Matches are recomputed in the background after the current user changes their availability, quiz answers, profile or filters.
+
+Returns:
+
+	200 OK:
+		{
+			"user_id": <current user ID> STRING,
+			"state": <"idle" (not recomputed since the server started, or too long ago to be remembered), "queued", "running", "done" or "failed"> STRING,
+			"rerun": <true if the matches changed again while running, so they are recomputed once more> BOOL,
+			"queued_at": <when the last recompute was queued, or null> STRING,
+			"started_at": <when the last recompute started, or null> STRING,
+			"finished_at": <when the last recompute finished, or null> STRING,
+			"error": <why the last recompute failed, only when "state" is "failed"> STRING
+		}
+	500 INTERNAL SERVER ERROR: Returns an error message if the server has no match queue.
+*/
+func GetMatchStatusHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	queue, ok := r.Context().Value(contextkeys.MatchQueueContextKey).(*workers.MatchQueue)
+	if !ok {
+		log.Println("No match queue in the request context")
+		http.Error(w, "Error getting match status", http.StatusInternalServerError)
+		return
 	}
 
-	// Return the subset of matches
-	return matches[offset:end], nil
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(queue.Status(userID))
+}
+
+// HELPER FUNC: Recompute the matches of userID in the background. Without a match queue in the request context, they are recomputed right away.
+func QueueMatchUpdate(r *http.Request, userID string) {
+	if queue, ok := r.Context().Value(contextkeys.MatchQueueContextKey).(*workers.MatchQueue); ok {
+		queue.Enqueue(userID)
+		return
+	}
+
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	if err := models.UpdateMatches(userID, db); err != nil {
+		log.Printf("Error updating user's matches: %v\n", err)
+	}
 }
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"go-react-backend/contextkeys"
+	"go-react-backend/models"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// most candidate slots a single proposal round can hold
+const MAX_PROPOSAL_SLOTS = 10
+
+/*
+POST /api/v1/dates/proposals: Proposes a new date with several candidate timeslots. The date is created as pending, and the other user can accept one of the slots or counter-propose.
+
+Request Body:
+
+	{
+		"user2_id": <the other user ID> STRING,
+		"slots": [
+			{
+				"date_start": "<when the date would start> ISO 8601 format",
+				"date_end": "<when the date would end> ISO 8601 format"
+			},
+			... // up to 10 slots
+		]
+	}
+
+Returns:
+
+	200 OK: Returns the new date and the first negotiation round
+		{
+			"date": <date object, showing the earliest slot until one is accepted>,
+			"proposal": {
+				"id": <unique proposal id> INT,
+				"date_id": <id of the date> INT,
+				"round": 1,
+				"proposer_id": <current user id> STRING,
+				"status": "open",
+				"accepted_slot_id": null,
+				"created_at": <timestamp> STRING,
+				"slots": [
+					{
+						"id": <unique slot id> INT,
+						"proposal_id": <id of the proposal> INT,
+						"date_start": "<slot start> ISO 8601 format",
+						"date_end": "<slot end> ISO 8601 format"
+					},
+					...
+				]
+			}
+		}
+	400 BAD REQUEST: Returns an error message if the request body is malformed, or a slot is invalid.
+	403 FORBIDDEN: Either user blocked the other, or REQUIRE_MUTUAL_LIKE_FOR_DATES is on and the users have not liked each other (same bodies as POST /api/v1/dates).
+	409 CONFLICT: A slot overlaps with a date of either user, or is outside of either user's availability (same bodies as POST /api/v1/dates).
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func PostDateProposalHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	var request struct {
+		User2ID string                `json:"user2_id"`
+		Slots   []models.ProposalSlot `json:"slots"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Invalid request body: %v\n", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if request.User2ID == "" || request.User2ID == userID {
+		log.Printf("Invalid user2_id provided: %s\n", request.User2ID)
+		http.Error(w, "Invalid user2_id provided", http.StatusBadRequest)
+		return
+	}
+
+	date := models.Date{
+		User1ID: userID,
+		User2ID: request.User2ID,
+		Status:  models.StatusPending,
+	}
+	if !CheckNotBlocked(w, date, userID, db) || !CheckMutualLike(w, date, db) || !CheckProposalSlots(w, date, request.Slots, db) {
+		return
+	}
+
+	dateID, proposal, err := models.ProposeDate(date, request.Slots, db)
+	if err != nil {
+		log.Printf("Failed to propose a date: %v\n", err)
+		http.Error(w, "Failed to propose date", http.StatusInternalServerError)
+		return
+	}
+
+	newDate, err := models.GetDate(dateID, db)
+	if err != nil {
+		log.Printf("Failed to retrieve proposed date: %v\n", err)
+		http.Error(w, "Retrieving proposed date failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"date":     newDate,
+		"proposal": proposal,
+	})
+}
+
+/*
+GET /api/v1/dates/{dateId}/proposals: Returns the negotiation history of a date, oldest round first. Only participants of the date can see it.
+
+Returns:
+
+	200 OK: list of rounds, in the same format as the "proposal" returned by POST /api/v1/dates/proposals.
+		"status" is "open" for the round waiting for an answer, "countered" for rounds answered with a new set of slots, "accepted" for the round whose "accepted_slot_id" was chosen,
+		and "closed" for a round left unanswered because the date was rejected, withdrawn or expired.
+	400 BAD REQUEST: invalid dateId
+	403 FORBIDDEN: the current user is not a participant of the date
+	404 NOT FOUND: no date with dateId exists
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func GetDateProposalsHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	date, ok := GetRequestedDate(w, r, db)
+	if !ok {
+		return
+	}
+	if _, err := models.DateRoleOf(date, userID); err != nil {
+		log.Printf("User is not a participant of date %d\n", date.ID)
+		http.Error(w, "Not a participant of this date", http.StatusForbidden)
+		return
+	}
+
+	proposals, err := models.GetProposals(date.ID, db)
+	if err != nil {
+		log.Printf("Failed to get proposals: %v\n", err)
+		http.Error(w, "Failed to get proposals", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(proposals)
+}
+
+/*
+POST /api/v1/dates/{dateId}/proposals: Counter-proposes a new set of slots for a pending date. Only the user who received the open round can counter it.
+
+Request Body:
+
+	{
+		"slots": [
+			{
+				"date_start": "<when the date would start> ISO 8601 format",
+				"date_end": "<when the date would end> ISO 8601 format"
+			},
+			... // up to 10 slots
+		]
+	}
+
+Returns:
+
+	200 OK: Returns the new round, in the same format as the "proposal" returned by POST /api/v1/dates/proposals
+	400 BAD REQUEST: Returns an error message if the request body is malformed, or a slot is invalid.
+	403 FORBIDDEN: The current user is not a participant, or sent the open round themselves (same body as PATCH /api/v1/dates),
+		or either user blocked the other (same body as POST /api/v1/dates).
+	404 NOT FOUND: no date with dateId exists
+	409 CONFLICT: The date is not pending (same body as PATCH /api/v1/dates), has no open round ("error": "no_open_proposal"),
+		or a slot overlaps with a date of either user or is outside of either user's availability (same bodies as POST /api/v1/dates).
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func CounterDateProposalHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	date, ok := GetRequestedDate(w, r, db)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Slots []models.ProposalSlot `json:"slots"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Invalid request body: %v\n", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !CheckNotBlocked(w, *date, userID, db) || !CheckProposalSlots(w, *date, request.Slots, db) {
+		return
+	}
+
+	proposal, err := models.CounterProposal(date, userID, request.Slots, db)
+	if err != nil {
+		log.Printf("Failed to counter proposal for date %d: %v\n", date.ID, err)
+		WriteProposalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(proposal)
+}
+
+/*
+POST /api/v1/dates/{dateId}/proposals/accept: Accepts one slot of the open round, confirming the date at that time. Only the user who received the open round can accept it.
+
+Request Body:
+
+	{
+		"slot_id": <id of a slot in the open round> INT
+	}
+
+Returns:
+
+	200 OK: Returns the confirmed date, with date_start and date_end set to the accepted slot
+	400 BAD REQUEST: the request body is malformed, or the slot is not part of the open round
+	403 FORBIDDEN: The current user is not a participant, or sent the open round themselves (same body as PATCH /api/v1/dates),
+		or either user blocked the other (same body as POST /api/v1/dates).
+	404 NOT FOUND: no date with dateId exists
+	409 CONFLICT: The date is not pending (same body as PATCH /api/v1/dates), has no open round ("error": "no_open_proposal"),
+		or either user already has a confirmed date at that time (same body as the "overlap_detected" response of POST /api/v1/dates).
+	500 INTERNAL SERVER ERROR: Returns an error message if an internal error occurs.
+*/
+func AcceptDateProposalHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
+
+	date, ok := GetRequestedDate(w, r, db)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		SlotID int `json:"slot_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Printf("Invalid request body: %v\n", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// make sure neither user blocked the other or got a confirmed date at that time in the meantime
+	if !CheckNotBlocked(w, *date, userID, db) {
+		return
+	}
+	open, err := models.GetOpenProposal(date.ID, db)
+	if err != nil {
+		log.Printf("Failed to get open proposal for date %d: %v\n", date.ID, err)
+		WriteProposalError(w, err)
+		return
+	}
+	if slot := open.FindSlot(request.SlotID); slot != nil {
+		slotDate := *date
+		slotDate.DateStart = slot.DateStart
+		slotDate.DateEnd = slot.DateEnd
+		if !CheckDateOverlap(w, slotDate, []string{models.StatusConfirmed}, db) {
+			return
+		}
+	}
+
+	err = models.AcceptProposalSlot(date, request.SlotID, userID, db)
+	if err != nil {
+		log.Printf("Failed to accept proposal for date %d: %v\n", date.ID, err)
+		WriteProposalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(date)
+}
+
+// HELPER FUNC: Get the date from the dateId url parameter. Returns false if an error response was written.
+func GetRequestedDate(w http.ResponseWriter, r *http.Request, db *sql.DB) (*models.Date, bool) {
+	dateIDStr := mux.Vars(r)["dateId"]
+	dateID, err := strconv.Atoi(dateIDStr)
+	if err != nil {
+		log.Printf("Invalid date ID: %s\n", dateIDStr)
+		http.Error(w, "Invalid date ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	date, err := models.GetDate(dateID, db)
+	if err != nil {
+		log.Printf("Failed to retrieve date: %v\n", err)
+		if errors.Is(err, models.ErrDateNotFound) {
+			http.Error(w, "Date not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Retrieving date failed", http.StatusInternalServerError)
+		return nil, false
+	}
+	return date, true
+}
+
+// HELPER FUNC: Validate every slot of a proposal for date, and make sure neither user is double booked or unavailable. Returns false if an error response was written.
+func CheckProposalSlots(w http.ResponseWriter, date models.Date, slots []models.ProposalSlot, db *sql.DB) bool {
+	if len(slots) == 0 || len(slots) > MAX_PROPOSAL_SLOTS {
+		log.Printf("Invalid number of slots provided: %d\n", len(slots))
+		http.Error(w, "A proposal must have between 1 and 10 slots", http.StatusBadRequest)
+		return false
+	}
+
+	statuses := []string{models.StatusPending, models.StatusConfirmed}
+	for _, slot := range slots {
+		slotDate := date
+		slotDate.DateStart = slot.DateStart
+		slotDate.DateEnd = slot.DateEnd
+
+		if err := ValidateIsoTimestamp(slotDate); err != nil {
+			log.Printf("Invalid slot provided: %v\n", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return false
+		}
+		if !CheckDateOverlap(w, slotDate, statuses, db) || !CheckDateAvailability(w, slotDate, db) {
+			return false
+		}
+	}
+	return true
+}
+
+// HELPER FUNC: Respond to a failed counter-proposal or acceptance with the matching status code
+func WriteProposalError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrNoOpenProposal):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":   "no_open_proposal",
+			"message": err.Error(),
+		})
+	case errors.Is(err, models.ErrSlotNotFound):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		WriteTransitionError(w, err)
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"go-react-backend/contextkeys"
+	"go-react-backend/models"
+	"log"
+	"net/http"
+)
+
+/*
+GET /api/v1/quiz: gets the active version of the compatibility quiz. Answers sent to PUT /api/v1/vector must have one value per question, in order.
+Users are only matched with users who answered the same version, so after a new version is activated a user is matched again once they retake the quiz.
+
+Returns:
+
+	200 OK: Successful fetch
+		{
+			"version": <questionnaire version> INT,
+			"questions": [
+				{
+					"id": <unique question id> INT,
+					"version_id": <questionnaire version> INT,
+					"position": <index of the answer in the similarity vector> INT,
+					"prompt": <the question> STRING,
+					"min_label": <what the lowest answer means> STRING,
+					"max_label": <what the highest answer means> STRING,
+					"min_value": <lowest allowed answer> INT,
+					"max_value": <highest allowed answer> INT
+				},
+				...
+			]
+		}
+	404 NOT FOUND: no questionnaire version is active
+	500 INTERNAL ERROR: Could not fetch the quiz
+*/
+func GetQuizHandler(w http.ResponseWriter, r *http.Request) {
+	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+
+	questionnaire, err := models.GetActiveQuestionnaire(db)
+	if err != nil {
+		log.Printf("Failed to retrieve active questionnaire: %v\n", err)
+		if errors.Is(err, models.ErrNoActiveQuestionnaire) {
+			http.Error(w, "No active quiz", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error getting quiz", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(questionnaire); err != nil {
+		log.Printf("Error writing response: %v\n", err)
+		http.Error(w, "Failed to process response", http.StatusInternalServerError)
+	}
+}
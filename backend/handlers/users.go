@@ -4,17 +4,21 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"go-react-backend/contextkeys"
 	"go-react-backend/models"
 	"log"
 	"net/http"
+	"slices"
+	"time"
 
 	"github.com/gorilla/mux"
 	_ "modernc.org/sqlite" // SQLite driver
 )
 
 /*
-GET /api/v1/users: Retrieves a list of all users.
+GET /api/v1/users: Retrieves a list of all users, leaving out users on either side of a block with the current user.
+Other users' match filter inputs, slot preferences and cancellation counts are private, see GET /api/v1/users/me for the full profile of the current user.
 
 Return:
 
@@ -27,6 +31,8 @@ Return:
 			"bio": <user's bio> STRING
 			"vector": <user's similarity vector> STRING
 			"profile_picture": <base64-encoded image string, currently empty> STRING
+			"time_zone": <IANA time zone of the user's availability, e.g. "America/Los_Angeles"> STRING
+			"age": <age in years, null if the user did not give their birth date> INT
 		},
 		...
 	]
@@ -35,6 +41,7 @@ Return:
 */
 func GetAllUsersHandler(w http.ResponseWriter, r *http.Request) {
 	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	userID := r.Context().Value(contextkeys.UserIDKey).(string)
 
 	// Fetch users from the database
 	users, err := models.GetAllUsers(db)
@@ -44,11 +51,50 @@ func GetAllUsersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// hide blocked users, in both directions
+	blocked, err := models.GetBlockedUserIDs(userID, db)
+	if err != nil {
+		log.Printf("Failed retrieving blocked users: %v\n", err)
+		http.Error(w, "Error retrieving all users", http.StatusInternalServerError)
+		return
+	}
+	profiles := []models.PublicUser{}
+	for _, user := range users {
+		if !blocked[user.ID] {
+			profiles = append(profiles, user.Public())
+		}
+	}
+
 	// Respond with user as JSON
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+	json.NewEncoder(w).Encode(profiles)
 }
 
+/*
+GET /api/v1/users/me: Retrieves the full profile of the current user.
+
+Return:
+
+	200 OK: Returns the user
+		{
+			"id": <unique id for the user> STRING
+			"name": <user's name> STRING
+			"email": <user's UNIQUE email> STRING
+			"bio": <user's bio> STRING
+			"vector": <user's similarity vector> STRING
+			"profile_picture": <base64-encoded image string, currently empty> STRING
+			"time_zone": <IANA time zone of the user's availability, e.g. "America/Los_Angeles"> STRING
+			"min_date_minutes": <shortest overlap offered as a date> INT
+			"slot_granularity_minutes": <overlaps are cut to slots of a multiple of this length> INT
+			"cancellation_count": <how many confirmed dates the user cancelled> INT
+			"gender": <"woman", "man" or "nonbinary", empty if not given> STRING
+			"seeking": <genders the user wants to be matched with, empty for anyone> []STRING
+			"birth_date": <YYYY-MM-DD, empty if not given> STRING
+			"class_year": <expected graduation year, 0 if not given> INT
+			"major": <user's major> STRING
+		}
+	500 INTERNAL ERROR: Returns an error message if the server is unable to retrieve the user.
+*/
 func GetCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
 	userId := r.Context().Value(contextkeys.UserIDKey).(string)
@@ -66,11 +112,33 @@ func GetCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
+/*
+GET /api/v1/users/{userId}: Retrieves the profile of another user, in the same format as GET /api/v1/users.
+
+Return:
+
+	200 OK: Returns the user
+	404 NOT FOUND: either user blocked the other
+	500 INTERNAL ERROR: Returns an error message if the server is unable to retrieve the user.
+*/
 func GetUserHandler(w http.ResponseWriter, r *http.Request) {
 	db := r.Context().Value(contextkeys.DbContextKey).(*sql.DB)
+	currentUserID := r.Context().Value(contextkeys.UserIDKey).(string)
 	vars := mux.Vars(r)
 	userID := vars["userId"]
 
+	// a blocked user looks the same as one that does not exist
+	blocked, err := models.IsBlocked(currentUserID, userID, db)
+	if err != nil {
+		log.Printf("Failed to check block: %v\n", err)
+		http.Error(w, "Error getting user", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
 	// Fetch users from the database
 	user, err := models.GetUserByID(userID, db)
 	if err != nil {
@@ -81,7 +149,7 @@ func GetUserHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Respond with user as JSON
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(user.Public())
 }
 
 /*
@@ -93,13 +161,14 @@ Request Body:
 		"id": <unique identifier for the user> STRING,
 		"name": <user's name> STRING,
 		"email": <UNIQUE email for the user> STRING,
-		"bio": <short biography of the user> STRING
+		"bio": <short biography of the user> STRING,
+		"time_zone": <IANA time zone of the user's availability, default "America/Los_Angeles"> STRING
 	}
 
 Return:
 
 	200 OK: Returns the newly created user object on success, with all fields populated.
-	400 BAD REQUEST: Returns an error message if the request body is not correctly formatted (e.g., missing or invalid fields).
+	400 BAD REQUEST: Returns an error message if the request body is not correctly formatted (e.g., missing or invalid fields, or an unknown time_zone).
 	500 INTERNAL ERROR: Returns an error message if the server fails to insert the new user into the database.
 */
 func PostUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -123,6 +192,15 @@ func PostUserHandler(w http.ResponseWriter, r *http.Request) {
 		user.ProfilePicture = string(decodedPicture)
 	}
 
+	// Validate the time zone (if provided)
+	if user.TimeZone != "" {
+		if _, err := models.LoadTimeZone(user.TimeZone); err != nil {
+			log.Printf("Invalid time zone provided (%s): %v\n", user.TimeZone, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Call the PostUser function to insert the user into the database
 	if err := models.PostUser(user, db); err != nil {
 		log.Printf("Error creating new user: %v\n", err)
@@ -144,13 +222,21 @@ Request Body: (If a field is not provided, it will not be changed)
 		"name": <new name for the user> STRING,
 		"email": <UNIQUE email for the user> STRING,
 		"bio": <short bio for the user> STRING,
-		"profile_picture": <empty for now> STRING
+		"profile_picture": <empty for now> STRING,
+		"time_zone": <IANA time zone of the user's availability, e.g. "America/New_York"> STRING,
+		"min_date_minutes": <shortest overlap offered as a date, 15 to 480, default 30> INT,
+		"slot_granularity_minutes": <overlaps are cut to slots of a multiple of this length: 15, 30, 60, 90 or 120, default 30> INT,
+		"gender": <"woman", "man" or "nonbinary"> STRING,
+		"seeking": <genders the user wants to be matched with, [] for anyone> []STRING,
+		"birth_date": <YYYY-MM-DD, the user must be at least 18> STRING,
+		"class_year": <expected graduation year> INT,
+		"major": <user's major> STRING
 	}
 
 Return:
 
 	200 OK: Returns the updated user object on success.
-	400 BAD REQUEST: Returns an error message if the request body is not formatted correctly (e.g., missing or invalid fields).
+	400 BAD REQUEST: Returns an error message if the request body is not formatted correctly (e.g., missing or invalid fields, an unknown time_zone, invalid slot preferences, or invalid profile attributes).
 	500 INTERNAL ERROR: Returns an error message if the server fails to update the user in the database.
 */
 func PatchUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -179,6 +265,29 @@ func PatchUserHandler(w http.ResponseWriter, r *http.Request) {
 		user.ProfilePicture = string(decodedPicture)
 	}
 
+	// Validate the time zone (if provided)
+	if user.TimeZone != "" {
+		if _, err := models.LoadTimeZone(user.TimeZone); err != nil {
+			log.Printf("Invalid time zone provided (%s): %v\n", user.TimeZone, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Validate the slot preferences (if provided)
+	if err := ValidateSlotPreferences(user); err != nil {
+		log.Printf("Invalid slot preferences provided: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the profile attributes used by match filters (if provided)
+	if err := ValidateProfileAttributes(user); err != nil {
+		log.Printf("Invalid profile attributes provided: %v\n", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Call patchUser to update the user in the database
 	if err := models.PatchUser(user, db); err != nil {
 		log.Printf("Error updating user: %v\n", err)
@@ -186,6 +295,12 @@ func PatchUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// overlaps with other users move with the time zone and slot preferences, and filters depend on the profile attributes
+	if user.TimeZone != "" || user.MinDateMinutes != 0 || user.SlotGranularityMinutes != 0 ||
+		user.Gender != "" || user.Seeking != nil || user.BirthDate != "" || user.ClassYear != 0 {
+		QueueMatchUpdate(r, userID)
+	}
+
 	// Respond with the updated user
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(user)
@@ -229,3 +344,39 @@ func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("User deleted successfully"))
 }
+
+// ValidateSlotPreferences checks the slot preferences of a user, ignoring the ones that are not set
+func ValidateSlotPreferences(user models.User) error {
+	if user.MinDateMinutes != 0 && (user.MinDateMinutes < 15 || user.MinDateMinutes > 480) {
+		return errors.New("invalid min_date_minutes; must be between 15 and 480")
+	}
+	if user.SlotGranularityMinutes != 0 && !slices.Contains(models.SLOT_GRANULARITIES, user.SlotGranularityMinutes) {
+		return errors.New("invalid slot_granularity_minutes; must be 15, 30, 60, 90 or 120")
+	}
+	return nil
+}
+
+// ValidateProfileAttributes checks the profile attributes used by match filters, ignoring the ones that are not set
+func ValidateProfileAttributes(user models.User) error {
+	if user.Gender != "" && !slices.Contains(models.GENDERS, user.Gender) {
+		return errors.New("invalid gender; must be woman, man or nonbinary")
+	}
+	for _, gender := range user.Seeking {
+		if !slices.Contains(models.GENDERS, gender) {
+			return errors.New("invalid seeking; genders must be woman, man or nonbinary")
+		}
+	}
+	if user.BirthDate != "" {
+		birthDate, err := time.Parse(time.DateOnly, user.BirthDate)
+		if err != nil {
+			return errors.New("invalid birth_date; must be formatted YYYY-MM-DD")
+		}
+		if birthDate.AddDate(models.MIN_AGE, 0, 0).After(time.Now()) {
+			return errors.New("invalid birth_date; users must be at least 18")
+		}
+	}
+	if user.ClassYear != 0 && (user.ClassYear < MIN_CLASS_YEAR || user.ClassYear > MAX_CLASS_YEAR) {
+		return errors.New("invalid class_year; must be between 1950 and 2100")
+	}
+	return nil
+}
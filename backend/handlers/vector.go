@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"go-react-backend/contextkeys"
 	"go-react-backend/models"
 	"log"
@@ -10,13 +11,16 @@ import (
 )
 
 /*
-GET /api/v1/vector: gets the similarity vector for the current user.
+GET /api/v1/vector: gets the similarity vector for the current user, how important each answer is to them, and which quiz version it answers.
 
 Returns:
 
 	200 OK: Successful fetch
 		{
-			"similarity_vector": <json array of ints that is the similarity vector>
+			"similarity_vector": <json array of ints that is the similarity vector>,
+			"importance": <json array with one of "irrelevant", "a little", "very", "mandatory" per answer, "a little" if never declared>,
+			"questionnaire_version": <quiz version the answers belong to> INT,
+			"stale": <true if the answers belong to an older quiz than GET /api/v1/quiz serves, and the quiz should be retaken> BOOL
 		}
 	500 INTERNAL ERROR: Could not fetch user vector
 */
@@ -33,10 +37,40 @@ func GetVectorHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// query importance
+	importance, err := models.GetUserImportance(userID, db)
+	if err != nil {
+		log.Printf("Failed to retrieve user importance: %v\n", err)
+		http.Error(w, "Error getting user vector", http.StatusInternalServerError)
+		return
+	}
+
+	// query which quiz the answers belong to
+	versionID, err := models.GetUserQuestionnaireVersion(userID, db)
+	if err != nil {
+		log.Printf("Failed to retrieve questionnaire version: %v\n", err)
+		http.Error(w, "Error getting user vector", http.StatusInternalServerError)
+		return
+	}
+	questionnaire, err := models.GetActiveQuestionnaire(db)
+	if err != nil && !errors.Is(err, models.ErrNoActiveQuestionnaire) {
+		log.Printf("Failed to retrieve active questionnaire: %v\n", err)
+		http.Error(w, "Error getting user vector", http.StatusInternalServerError)
+		return
+	}
+
 	// Create a response struct
 	response := struct {
-		SimilarityVector []int `json:"similarity_vector"`
-	}{SimilarityVector: vector}
+		SimilarityVector     []int    `json:"similarity_vector"`
+		Importance           []string `json:"importance"`
+		QuestionnaireVersion int      `json:"questionnaire_version"`
+		Stale                bool     `json:"stale"`
+	}{
+		SimilarityVector:     vector,
+		Importance:           models.FillImportance(importance, len(vector)),
+		QuestionnaireVersion: versionID,
+		Stale:                questionnaire != nil && questionnaire.Version != versionID,
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -47,18 +81,21 @@ func GetVectorHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 /*
-PUT /api/v1/vector: Inserts or updates the similarity vector for the current user.
+PUT /api/v1/vector: Inserts or updates the similarity vector for the current user, and optionally how important each answer is to them.
+The answers must match the quiz served by GET /api/v1/quiz: one answer per question, in order, within each question's min_value and max_value.
+Answers marked "mandatory" filter out every user whose answer is more than a quarter of the question's scale away (1 step on a 1 to 5 scale); the other values weigh the answer in the compatibility score.
 
 Request Body:
 
 	{
-	    "similarity_vector": <[json array of ints]>
+	    "similarity_vector": <[json array of ints]>,
+	    "importance": <[json array with one of "irrelevant", "a little", "very", "mandatory" per answer]> OPTIONAL. If omitted, the current importance is kept, or reset to "a little" for every answer if the answers are for a new quiz version
 	}
 
 Returns:
 
 	200 OK: Successful update
-	400 BAD REQUEST: response body was not formatted correctly
+	400 BAD REQUEST: response body was not formatted correctly, the answers do not fit the active quiz, or importance does not have one valid value per answer
 	500 INTERNAL ERROR: Could not update
 */
 func PutVectorHandler(w http.ResponseWriter, r *http.Request) {
@@ -67,7 +104,8 @@ func PutVectorHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(contextkeys.UserIDKey).(string)
 
 	var requestBody struct {
-		Vector []int `json:"similarity_vector"`
+		Vector     []int    `json:"similarity_vector"`
+		Importance []string `json:"importance"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
@@ -76,14 +114,37 @@ func PutVectorHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// query vector
-	err := models.UpdateUserVector(requestBody.Vector, userID, db)
+	// answers are stored against the active quiz, and rejected if they do not fit it
+	questionnaire, err := models.GetActiveQuestionnaire(db)
+	if err != nil {
+		log.Printf("Failed to retrieve active questionnaire: %v\n", err)
+		http.Error(w, "Error updating user vector", http.StatusInternalServerError)
+		return
+	}
+
+	if requestBody.Importance != nil {
+		if err := models.ValidateImportance(requestBody.Importance, len(requestBody.Vector)); err != nil {
+			log.Printf("Invalid importance provided: %v\n", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// answers and importance are stored together
+	err = models.UpdateUserVector(requestBody.Vector, requestBody.Importance, questionnaire.Version, userID, db)
 	if err != nil {
 		log.Printf("Failed to update user vector: %v\n", err)
+		if errors.Is(err, models.ErrInvalidVector) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Error updating user vector", http.StatusInternalServerError)
 		return
 	}
 
+	// similarity scores change with the answers
+	QueueMatchUpdate(r, userID)
+
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Vector updated successfully"))
 }
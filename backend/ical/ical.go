@@ -0,0 +1,99 @@
+/*
+Minimal RFC 5545 (iCalendar) support: enough to publish dates as VEVENTs
+*/
+
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// values for the STATUS property of a VEVENT
+const (
+	StatusTentative = "TENTATIVE"
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// format of UTC DATE-TIME values
+const dateTimeFormat = "20060102T150405Z"
+
+// longest content line allowed before folding, in octets
+const maxLineLength = 75
+
+// Event is a single VEVENT
+type Event struct {
+	UID         string // stable, globally unique id of the event
+	Summary     string
+	Description string
+	Start       time.Time
+	End         time.Time
+	Stamp       time.Time // when the event was created
+	Status      string    // StatusTentative, StatusConfirmed or StatusCancelled
+}
+
+// WriteCalendar writes a VCALENDAR named name containing events
+func WriteCalendar(w io.Writer, name string, events []Event) error {
+	out := bufio.NewWriter(w)
+
+	writeLine(out, "BEGIN:VCALENDAR")
+	writeLine(out, "VERSION:2.0")
+	writeLine(out, "PRODID:-//bdate//dates//EN")
+	writeLine(out, "CALSCALE:GREGORIAN")
+	writeLine(out, "METHOD:PUBLISH")
+	writeLine(out, "X-WR-CALNAME:"+EscapeText(name))
+
+	for _, event := range events {
+		writeLine(out, "BEGIN:VEVENT")
+		writeLine(out, "UID:"+event.UID)
+		writeLine(out, "DTSTAMP:"+event.Stamp.UTC().Format(dateTimeFormat))
+		writeLine(out, "DTSTART:"+event.Start.UTC().Format(dateTimeFormat))
+		writeLine(out, "DTEND:"+event.End.UTC().Format(dateTimeFormat))
+		writeLine(out, "SUMMARY:"+EscapeText(event.Summary))
+		if event.Description != "" {
+			writeLine(out, "DESCRIPTION:"+EscapeText(event.Description))
+		}
+		if event.Status != "" {
+			writeLine(out, "STATUS:"+event.Status)
+		}
+		writeLine(out, "END:VEVENT")
+	}
+
+	writeLine(out, "END:VCALENDAR")
+	return out.Flush()
+}
+
+// EscapeText escapes a TEXT value (backslashes, semicolons, commas and newlines)
+func EscapeText(text string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	)
+	return replacer.Replace(text)
+}
+
+// HELPER: write a content line terminated by CRLF, folding it if it is too long
+func writeLine(w *bufio.Writer, line string) {
+	for len(line) > maxLineLength {
+		// never split a multi-byte UTF-8 character
+		cut := maxLineLength
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		fmt.Fprint(w, line[:cut], "\r\n")
+		line = " " + line[cut:]
+	}
+	fmt.Fprint(w, line, "\r\n")
+}
+
+// HELPER: whether b is the first byte of a UTF-8 character
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
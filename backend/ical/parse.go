@@ -0,0 +1,313 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Period is a block of time during which the calendar owner is busy
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// BusyEvent is a VEVENT that blocks time, possibly repeating. See Occurrences for the time it blocks.
+type BusyEvent struct {
+	Period                    // first occurrence, in the time zone of DTSTART (its TZID, UTC, or the importing user's zone for floating times)
+	Rule          *Recurrence // how the event repeats, nil for a single event
+	Exceptions    []time.Time // EXDATE date-times: occurrences starting at these times are skipped
+	ExceptionDays []time.Time // EXDATE dates: occurrences starting on these days are skipped
+}
+
+// Calendar holds the busy time found in an iCalendar file
+type Calendar struct {
+	Events []BusyEvent // opaque VEVENTs, cancelled and transparent events are left out
+	Busy   []Period    // BUSY periods of VFREEBUSY components
+}
+
+var ErrNotCalendar = errors.New("file is not an iCalendar file")
+
+// property is a single unfolded content line
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+/*
+Parse reads an iCalendar file and collects the time it marks as busy.
+Floating times (without "Z" or TZID) are read in loc.
+
+Daily and weekly RRULEs are understood, with INTERVAL, COUNT, UNTIL, BYDAY, WKST and EXDATE, and are expanded in the time zone of DTSTART.
+Other rules and RDATE return ErrUnsupportedRule instead of blocking the wrong time.
+*/
+func Parse(r io.Reader, loc *time.Location) (*Calendar, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, ErrNotCalendar
+	}
+
+	calendar := &Calendar{}
+	var event []property // properties of the VEVENT being read, nil outside of one
+	inFreeBusy := false
+
+	for _, line := range lines {
+		prop, err := parseProperty(line)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VEVENT"):
+			event = []property{}
+		case prop.name == "END" && strings.EqualFold(prop.value, "VEVENT"):
+			busy, ok, err := busyEvent(event, loc)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				calendar.Events = append(calendar.Events, busy)
+			}
+			event = nil
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VFREEBUSY"):
+			inFreeBusy = true
+		case prop.name == "END" && strings.EqualFold(prop.value, "VFREEBUSY"):
+			inFreeBusy = false
+		case event != nil:
+			event = append(event, prop)
+		case inFreeBusy && prop.name == "FREEBUSY":
+			// FREE periods do not block anything
+			if fbType, ok := prop.params["FBTYPE"]; ok && strings.EqualFold(fbType, "FREE") {
+				continue
+			}
+			for _, value := range strings.Split(prop.value, ",") {
+				period, err := parsePeriod(value, loc)
+				if err != nil {
+					return nil, err
+				}
+				calendar.Busy = append(calendar.Busy, period)
+			}
+		}
+	}
+
+	return calendar, nil
+}
+
+// HELPER: turn the properties of a VEVENT into a busy event. Returns false for events that do not block time.
+func busyEvent(props []property, loc *time.Location) (BusyEvent, bool, error) {
+	var event BusyEvent
+	var duration time.Duration
+	var rrule string
+	var exdates []property
+	allDay := false
+
+	for _, prop := range props {
+		var err error
+		switch prop.name {
+		case "DTSTART":
+			event.Start, err = parseDateTime(prop, loc)
+			allDay = strings.EqualFold(prop.params["VALUE"], "DATE")
+		case "DTEND":
+			event.End, err = parseDateTime(prop, loc)
+		case "DURATION":
+			duration, err = parseDuration(prop.value)
+		case "RRULE":
+			rrule = prop.value
+		case "EXDATE":
+			exdates = append(exdates, prop)
+		case "RDATE":
+			return event, false, fmt.Errorf("%w: RDATE", ErrUnsupportedRule)
+		case "TRANSP":
+			if strings.EqualFold(prop.value, "TRANSPARENT") {
+				return event, false, nil
+			}
+		case "STATUS":
+			if strings.EqualFold(prop.value, "CANCELLED") {
+				return event, false, nil
+			}
+		}
+		if err != nil {
+			return event, false, err
+		}
+	}
+
+	if event.Start.IsZero() {
+		return event, false, errors.New("VEVENT is missing DTSTART")
+	}
+	if event.End.IsZero() {
+		switch {
+		case duration > 0:
+			event.End = event.Start.Add(duration)
+		case allDay:
+			event.End = event.Start.AddDate(0, 0, 1)
+		default:
+			// an event without an end takes up no time
+			return event, false, nil
+		}
+	}
+
+	// dates without a time zone of their own belong to the time zone of DTSTART
+	if rrule != "" {
+		rule, err := parseRule(rrule, event.Start.Location())
+		if err != nil {
+			return event, false, err
+		}
+		event.Rule = rule
+	}
+	for _, prop := range exdates {
+		for _, value := range strings.Split(prop.value, ",") {
+			exception, err := parseDateTime(property{name: prop.name, params: prop.params, value: value}, event.Start.Location())
+			if err != nil {
+				return event, false, err
+			}
+			if strings.EqualFold(prop.params["VALUE"], "DATE") || len(value) == len("20060102") {
+				event.ExceptionDays = append(event.ExceptionDays, exception)
+			} else {
+				event.Exceptions = append(event.Exceptions, exception)
+			}
+		}
+	}
+	return event, true, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// HELPER: parse a DATE or DATE-TIME value, honoring "Z" and TZID
+func parseDateTime(prop property, loc *time.Location) (time.Time, error) {
+	if tzid, ok := prop.params["TZID"]; ok {
+		if tz, err := time.LoadLocation(tzid); err == nil {
+			loc = tz
+		}
+	}
+
+	value := prop.value
+	switch {
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse("20060102T150405Z", value)
+	case len(value) == len("20060102"):
+		return time.ParseInLocation("20060102", value, loc)
+	default:
+		t, err := time.ParseInLocation("20060102T150405", value, loc)
+		if err != nil {
+			return t, fmt.Errorf("invalid %s value %q: %w", prop.name, value, err)
+		}
+		return t, nil
+	}
+}
+
+// HELPER: parse a PERIOD value, "start/end" or "start/duration"
+func parsePeriod(value string, loc *time.Location) (Period, error) {
+	startValue, endValue, ok := strings.Cut(value, "/")
+	if !ok {
+		return Period{}, fmt.Errorf("invalid period %q", value)
+	}
+
+	start, err := parseDateTime(property{name: "FREEBUSY", value: startValue}, loc)
+	if err != nil {
+		return Period{}, err
+	}
+	if strings.HasPrefix(endValue, "P") {
+		duration, err := parseDuration(endValue)
+		if err != nil {
+			return Period{}, err
+		}
+		return Period{Start: start, End: start.Add(duration)}, nil
+	}
+	end, err := parseDateTime(property{name: "FREEBUSY", value: endValue}, loc)
+	if err != nil {
+		return Period{}, err
+	}
+	return Period{Start: start, End: end}, nil
+}
+
+// HELPER: parse a DURATION value such as "PT1H30M" or "P1D"
+func parseDuration(value string) (time.Duration, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(value, "+"), "P")
+	if rest == value || rest == "" {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	units := map[byte]time.Duration{
+		'W': 7 * 24 * time.Hour,
+		'D': 24 * time.Hour,
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+	}
+	var duration time.Duration
+	number := ""
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case c == 'T':
+		case c >= '0' && c <= '9':
+			number += string(c)
+		default:
+			unit, ok := units[c]
+			n, err := strconv.Atoi(number)
+			if !ok || err != nil {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			duration += time.Duration(n) * unit
+			number = ""
+		}
+	}
+	return duration, nil
+}
+
+// HELPER: split a content line into its name, parameters and value
+func parseProperty(line string) (property, error) {
+	nameAndParams, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return property{}, fmt.Errorf("invalid content line %q", line)
+	}
+
+	parts := strings.Split(nameAndParams, ";")
+	prop := property{
+		name:   strings.ToUpper(parts[0]),
+		params: make(map[string]string),
+		value:  value,
+	}
+	for _, param := range parts[1:] {
+		key, paramValue, _ := strings.Cut(param, "=")
+		prop.params[strings.ToUpper(key)] = strings.Trim(paramValue, `"`)
+	}
+	return prop, nil
+}
+
+// HELPER: read all content lines, joining folded lines back together
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read calendar: %w", err)
+	}
+	return lines, nil
+}
@@ -0,0 +1,305 @@
+package ical
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// HELPER: an iCalendar file made of lines, wrapped in a VCALENDAR
+func calendarFile(lines ...string) string {
+	return strings.Join(append(append([]string{"BEGIN:VCALENDAR", "VERSION:2.0"}, lines...), "END:VCALENDAR"), "\r\n") + "\r\n"
+}
+
+// HELPER: the lines of a VEVENT with the given properties
+func event(props ...string) []string {
+	return append(append([]string{"BEGIN:VEVENT"}, props...), "END:VEVENT")
+}
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("loading %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestParseNotCalendar(t *testing.T) {
+	for _, input := range []string{"", "BEGIN:VCARD\r\nEND:VCARD\r\n", "hello"} {
+		if _, err := Parse(strings.NewReader(input), time.UTC); !errors.Is(err, ErrNotCalendar) {
+			t.Errorf("Parse(%q) error = %v, want %v", input, err, ErrNotCalendar)
+		}
+	}
+}
+
+func TestParseEvents(t *testing.T) {
+	la := mustLoad(t, "America/Los_Angeles")
+
+	tests := []struct {
+		name   string
+		lines  []string
+		want   []Period // Periods of the busy events, in order
+		errMsg string   // non-empty if Parse should fail with an error containing it
+	}{
+		{
+			name:  "utc start and end",
+			lines: event("DTSTART:20250310T170000Z", "DTEND:20250310T180000Z"),
+			want:  []Period{{time.Date(2025, 3, 10, 17, 0, 0, 0, time.UTC), time.Date(2025, 3, 10, 18, 0, 0, 0, time.UTC)}},
+		},
+		{
+			name:  "floating time is read in loc",
+			lines: event("DTSTART:20250310T090000", "DTEND:20250310T100000"),
+			want:  []Period{{time.Date(2025, 3, 10, 9, 0, 0, 0, la), time.Date(2025, 3, 10, 10, 0, 0, 0, la)}},
+		},
+		{
+			name:  "TZID overrides loc",
+			lines: event("DTSTART;TZID=Europe/Paris:20250310T090000", "DTEND;TZID=Europe/Paris:20250310T100000"),
+			want:  []Period{{time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC), time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)}},
+		},
+		{
+			name:  "duration instead of end",
+			lines: event("DTSTART:20250310T170000Z", "DURATION:PT1H30M"),
+			want:  []Period{{time.Date(2025, 3, 10, 17, 0, 0, 0, time.UTC), time.Date(2025, 3, 10, 18, 30, 0, 0, time.UTC)}},
+		},
+		{
+			name:  "all-day event lasts a day",
+			lines: event("DTSTART;VALUE=DATE:20250310"),
+			want:  []Period{{time.Date(2025, 3, 10, 0, 0, 0, 0, la), time.Date(2025, 3, 11, 0, 0, 0, 0, la)}},
+		},
+		{
+			name:  "folded lines are unfolded",
+			lines: event("DTSTART:20250310T17", " 0000Z", "DTEND:20250310T180000Z"),
+			want:  []Period{{time.Date(2025, 3, 10, 17, 0, 0, 0, time.UTC), time.Date(2025, 3, 10, 18, 0, 0, 0, time.UTC)}},
+		},
+		{
+			name:  "transparent events do not block time",
+			lines: event("DTSTART:20250310T170000Z", "DTEND:20250310T180000Z", "TRANSP:TRANSPARENT"),
+		},
+		{
+			name:  "cancelled events do not block time",
+			lines: event("DTSTART:20250310T170000Z", "DTEND:20250310T180000Z", "STATUS:CANCELLED"),
+		},
+		{
+			name:  "events without an end take up no time",
+			lines: event("DTSTART:20250310T170000Z"),
+		},
+		{
+			name:   "missing DTSTART",
+			lines:  event("DTEND:20250310T180000Z"),
+			errMsg: "missing DTSTART",
+		},
+		{
+			name:   "invalid DTSTART",
+			lines:  event("DTSTART:yesterday", "DTEND:20250310T180000Z"),
+			errMsg: "invalid DTSTART",
+		},
+	}
+
+	for _, test := range tests {
+		calendar, err := Parse(strings.NewReader(calendarFile(test.lines...)), la)
+		if test.errMsg != "" {
+			if err == nil || !strings.Contains(err.Error(), test.errMsg) {
+				t.Errorf("%s: error = %v, want one containing %q", test.name, err, test.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if len(calendar.Events) != len(test.want) {
+			t.Errorf("%s: got %d events, want %d", test.name, len(calendar.Events), len(test.want))
+			continue
+		}
+		for i, event := range calendar.Events {
+			if !event.Start.Equal(test.want[i].Start) || !event.End.Equal(test.want[i].End) {
+				t.Errorf("%s: event %d is %v - %v, want %v - %v", test.name, i, event.Start, event.End, test.want[i].Start, test.want[i].End)
+			}
+			if event.Rule != nil {
+				t.Errorf("%s: event %d repeats, want a single event", test.name, i)
+			}
+		}
+	}
+}
+
+func TestParseFreeBusy(t *testing.T) {
+	input := calendarFile(
+		"BEGIN:VFREEBUSY",
+		"FREEBUSY:20250310T170000Z/20250310T180000Z,20250311T090000Z/PT30M",
+		"FREEBUSY;FBTYPE=FREE:20250312T090000Z/20250312T170000Z",
+		"FREEBUSY;FBTYPE=BUSY-TENTATIVE:20250313T090000Z/PT1H",
+		"END:VFREEBUSY",
+		"FREEBUSY:20250314T090000Z/PT1H", // outside of a VFREEBUSY
+	)
+
+	calendar, err := Parse(strings.NewReader(input), time.UTC)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := []Period{
+		{time.Date(2025, 3, 10, 17, 0, 0, 0, time.UTC), time.Date(2025, 3, 10, 18, 0, 0, 0, time.UTC)},
+		{time.Date(2025, 3, 11, 9, 0, 0, 0, time.UTC), time.Date(2025, 3, 11, 9, 30, 0, 0, time.UTC)},
+		{time.Date(2025, 3, 13, 9, 0, 0, 0, time.UTC), time.Date(2025, 3, 13, 10, 0, 0, 0, time.UTC)},
+	}
+	if len(calendar.Busy) != len(want) {
+		t.Fatalf("got busy periods %v, want %v", calendar.Busy, want)
+	}
+	for i, period := range calendar.Busy {
+		if !period.Start.Equal(want[i].Start) || !period.End.Equal(want[i].End) {
+			t.Errorf("busy period %d is %v - %v, want %v - %v", i, period.Start, period.End, want[i].Start, want[i].End)
+		}
+	}
+
+	if _, err := Parse(strings.NewReader(calendarFile("BEGIN:VFREEBUSY", "FREEBUSY:20250310T170000Z", "END:VFREEBUSY")), time.UTC); err == nil {
+		t.Error("a FREEBUSY value without an end parsed without error")
+	}
+}
+
+func TestParseRecurrence(t *testing.T) {
+	la := mustLoad(t, "America/Los_Angeles")
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2025, month, day, hour, 0, 0, 0, la)
+	}
+
+	tests := []struct {
+		name     string
+		props    []string
+		from, to time.Time
+		want     []time.Time // starts of the occurrences in [from, to)
+	}{
+		{
+			name:  "weekly on the day of DTSTART",
+			props: []string{"DTSTART:20250303T090000", "DTEND:20250303T100000", "RRULE:FREQ=WEEKLY"},
+			from:  at(3, 1, 0), to: at(3, 25, 0),
+			want: []time.Time{at(3, 3, 9), at(3, 10, 9), at(3, 17, 9), at(3, 24, 9)},
+		},
+		{
+			name:  "weekly BYDAY with COUNT, DTSTART included",
+			props: []string{"DTSTART:20250303T090000", "DTEND:20250303T100000", "RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=3"},
+			from:  at(3, 1, 0), to: at(4, 1, 0),
+			want: []time.Time{at(3, 3, 9), at(3, 5, 9), at(3, 10, 9)},
+		},
+		{
+			name:  "every other week, counted from the week of DTSTART",
+			props: []string{"DTSTART:20250304T090000", "DTEND:20250304T100000", "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH"},
+			from:  at(3, 1, 0), to: at(3, 22, 0),
+			want: []time.Time{at(3, 4, 9), at(3, 6, 9), at(3, 18, 9), at(3, 20, 9)},
+		},
+		{
+			name:  "daily with COUNT and EXDATE",
+			props: []string{"DTSTART:20250303T090000", "DTEND:20250303T100000", "RRULE:FREQ=DAILY;COUNT=4", "EXDATE:20250304T090000"},
+			from:  at(3, 1, 0), to: at(4, 1, 0),
+			want: []time.Time{at(3, 3, 9), at(3, 5, 9), at(3, 6, 9)},
+		},
+		{
+			name:  "daily INTERVAL with an all-day EXDATE",
+			props: []string{"DTSTART:20250303T090000", "DTEND:20250303T100000", "RRULE:FREQ=DAILY;INTERVAL=3", "EXDATE;VALUE=DATE:20250306"},
+			from:  at(3, 1, 0), to: at(3, 13, 0),
+			want: []time.Time{at(3, 3, 9), at(3, 9, 9), at(3, 12, 9)},
+		},
+		{
+			name:  "date-only UNTIL includes that day",
+			props: []string{"DTSTART:20250303T090000", "DTEND:20250303T100000", "RRULE:FREQ=DAILY;UNTIL=20250305"},
+			from:  at(3, 1, 0), to: at(4, 1, 0),
+			want: []time.Time{at(3, 3, 9), at(3, 4, 9), at(3, 5, 9)},
+		},
+		{
+			name:  "occurrences keep their wall clock time across daylight saving time",
+			props: []string{"DTSTART:20250306T090000", "DTEND:20250306T100000", "RRULE:FREQ=WEEKLY"},
+			from:  at(3, 10, 0), to: at(3, 14, 0),
+			want: []time.Time{at(3, 13, 9)},
+		},
+		{
+			name:  "occurrences that started before from but are still running",
+			props: []string{"DTSTART:20250303T090000", "DTEND:20250303T120000", "RRULE:FREQ=DAILY"},
+			from:  at(3, 4, 10), to: at(3, 5, 0),
+			want: []time.Time{at(3, 4, 9)},
+		},
+	}
+
+	for _, test := range tests {
+		calendar, err := Parse(strings.NewReader(calendarFile(event(test.props...)...)), la)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if len(calendar.Events) != 1 || calendar.Events[0].Rule == nil {
+			t.Errorf("%s: got events %v, want one repeating event", test.name, calendar.Events)
+			continue
+		}
+
+		occurrences := calendar.Events[0].Occurrences(test.from, test.to)
+		if len(occurrences) != len(test.want) {
+			t.Errorf("%s: got occurrences %v, want starts %v", test.name, occurrences, test.want)
+			continue
+		}
+		for i, occurrence := range occurrences {
+			if !occurrence.Start.Equal(test.want[i]) {
+				t.Errorf("%s: occurrence %d starts at %v, want %v", test.name, i, occurrence.Start, test.want[i])
+			}
+			if occurrence.End.Sub(occurrence.Start) != calendar.Events[0].End.Sub(calendar.Events[0].Start) {
+				t.Errorf("%s: occurrence %d lasts %v, want the length of the first one", test.name, i, occurrence.End.Sub(occurrence.Start))
+			}
+		}
+	}
+}
+
+func TestParseRecurrenceInEventTimeZone(t *testing.T) {
+	la := mustLoad(t, "America/Los_Angeles")
+	tokyo := mustLoad(t, "Asia/Tokyo")
+
+	// Mondays and Wednesdays at 9:00 in Tokyo are Sundays and Tuesdays in Los Angeles, the all-day EXDATE is a day in Tokyo
+	input := calendarFile(event(
+		"DTSTART;TZID=Asia/Tokyo:20250303T090000", "DTEND;TZID=Asia/Tokyo:20250303T100000",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,WE", "EXDATE;VALUE=DATE:20250305",
+	)...)
+	calendar, err := Parse(strings.NewReader(input), la)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	occurrences := calendar.Events[0].Occurrences(time.Date(2025, 3, 1, 0, 0, 0, 0, la), time.Date(2025, 3, 11, 0, 0, 0, 0, la))
+	want := []time.Time{time.Date(2025, 3, 3, 9, 0, 0, 0, tokyo), time.Date(2025, 3, 10, 9, 0, 0, 0, tokyo)}
+	if len(occurrences) != len(want) {
+		t.Fatalf("got occurrences %v, want starts %v", occurrences, want)
+	}
+	for i, occurrence := range occurrences {
+		if !occurrence.Start.Equal(want[i]) {
+			t.Errorf("occurrence %d starts at %v, want %v", i, occurrence.Start, want[i])
+		}
+	}
+}
+
+func TestParseUnsupportedRecurrence(t *testing.T) {
+	unsupported := map[string]string{
+		"monthly":       "RRULE:FREQ=MONTHLY",
+		"yearly":        "RRULE:FREQ=YEARLY;BYMONTH=3",
+		"BYMONTH":       "RRULE:FREQ=WEEKLY;BYMONTH=3",
+		"BYSETPOS":      "RRULE:FREQ=WEEKLY;BYDAY=MO,TU;BYSETPOS=1",
+		"BYDAY ordinal": "RRULE:FREQ=WEEKLY;BYDAY=1MO",
+		"RDATE":         "RDATE:20250310T090000",
+	}
+	for name, prop := range unsupported {
+		input := calendarFile(event("DTSTART:20250303T090000Z", "DTEND:20250303T100000Z", prop)...)
+		if _, err := Parse(strings.NewReader(input), time.UTC); !errors.Is(err, ErrUnsupportedRule) {
+			t.Errorf("%s: error = %v, want %v", name, err, ErrUnsupportedRule)
+		}
+	}
+
+	invalid := map[string]string{
+		"COUNT and UNTIL": "RRULE:FREQ=DAILY;COUNT=2;UNTIL=20250310",
+		"missing FREQ":    "RRULE:COUNT=2",
+		"zero INTERVAL":   "RRULE:FREQ=DAILY;INTERVAL=0",
+		"negative COUNT":  "RRULE:FREQ=DAILY;COUNT=-1",
+		"unknown WKST":    "RRULE:FREQ=WEEKLY;WKST=XX",
+		"invalid UNTIL":   "RRULE:FREQ=DAILY;UNTIL=soon",
+	}
+	for name, prop := range invalid {
+		input := calendarFile(event("DTSTART:20250303T090000Z", "DTEND:20250303T100000Z", prop)...)
+		if _, err := Parse(strings.NewReader(input), time.UTC); err == nil {
+			t.Errorf("%s: parsed without error", name)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Recurrence rules of busy events: the daily and weekly RRULEs calendars use for repeating meetings and classes
+*/
+
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// frequencies of the RRULEs that are understood
+const (
+	FreqDaily  = "DAILY"
+	FreqWeekly = "WEEKLY"
+)
+
+var ErrUnsupportedRule = errors.New("unsupported recurrence rule")
+
+// Recurrence is a parsed RRULE
+type Recurrence struct {
+	Frequency string         // FreqDaily or FreqWeekly
+	Interval  int            // repeats every Interval days or weeks
+	Weekdays  []time.Weekday // BYDAY: weekly rules repeat on these days (default: the day of DTSTART), daily rules skip every other day (default: none)
+	Count     int            // occurrences in total, DTSTART included. 0 if there is no limit
+	Until     time.Time      // last possible start, zero if it repeats forever
+	WeekStart time.Weekday   // WKST, the day weeks start on when counting weekly intervals
+}
+
+/*
+HELPER: parse an RRULE value. Only FREQ=DAILY and FREQ=WEEKLY with INTERVAL, COUNT, UNTIL, BYDAY and WKST are understood.
+Any other frequency or part returns ErrUnsupportedRule, since ignoring it would make the event block the wrong time.
+*/
+func parseRule(rrule string, loc *time.Location) (*Recurrence, error) {
+	rule := &Recurrence{Interval: 1, WeekStart: time.Monday}
+	for _, part := range strings.Split(rrule, ";") {
+		if part == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(part, "=")
+
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Frequency = strings.ToUpper(value)
+			if rule.Frequency != FreqDaily && rule.Frequency != FreqWeekly {
+				return nil, fmt.Errorf("%w: FREQ=%s, only DAILY and WEEKLY are supported", ErrUnsupportedRule, value)
+			}
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(value)
+			if err != nil || rule.Interval < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL value %q", value)
+			}
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(value)
+			if err != nil || rule.Count < 1 {
+				return nil, fmt.Errorf("invalid COUNT value %q", value)
+			}
+		case "UNTIL":
+			rule.Until, err = parseDateTime(property{name: "UNTIL", params: map[string]string{}, value: value}, loc)
+			if len(value) == len("20060102") {
+				// a date includes every occurrence starting on that day
+				rule.Until = rule.Until.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := weekdays[strings.ToUpper(day)]
+				if !ok {
+					return nil, fmt.Errorf("%w: BYDAY=%s", ErrUnsupportedRule, day)
+				}
+				rule.Weekdays = append(rule.Weekdays, weekday)
+			}
+		case "WKST":
+			weekday, ok := weekdays[strings.ToUpper(value)]
+			if !ok {
+				return nil, fmt.Errorf("invalid WKST value %q", value)
+			}
+			rule.WeekStart = weekday
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedRule, strings.ToUpper(key))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rule.Frequency == "" {
+		return nil, errors.New("RRULE is missing FREQ")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return nil, errors.New("RRULE cannot have both COUNT and UNTIL")
+	}
+	return rule, nil
+}
+
+/*
+Occurrences returns the periods of event that overlap [from, to), in order.
+A repeating event is expanded in the time zone of DTSTART: occurrences start at its wall clock time there, also across daylight saving time changes,
+BYDAY and all-day EXDATEs are matched against its days there, and EXDATEs are left out.
+*/
+func (e BusyEvent) Occurrences(from, to time.Time) []Period {
+	if e.Rule == nil {
+		if e.Start.Before(to) && e.End.After(from) {
+			return []Period{e.Period}
+		}
+		return nil
+	}
+
+	duration := e.End.Sub(e.Start)
+	var periods []Period
+	e.Rule.each(e.Start, to, func(start time.Time) {
+		end := start.Add(duration)
+		if end.After(from) && !e.excluded(start) {
+			periods = append(periods, Period{Start: start, End: end})
+		}
+	})
+	return periods
+}
+
+// HELPER: call yield with every start of the rule before to, in order, with first (DTSTART) as the first one
+func (r *Recurrence) each(first time.Time, to time.Time, yield func(time.Time)) {
+	at := func(day time.Time) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), first.Hour(), first.Minute(), first.Second(), 0, first.Location())
+	}
+
+	// returns false once no later start can be yielded
+	count := 0
+	emit := func(start time.Time) bool {
+		if !start.Before(to) || (!r.Until.IsZero() && start.After(r.Until)) || (r.Count > 0 && count >= r.Count) {
+			return false
+		}
+		count++
+		yield(start)
+		return true
+	}
+
+	switch r.Frequency {
+	case FreqDaily:
+		for days := 0; ; days += r.Interval {
+			start := at(first.AddDate(0, 0, days))
+			if days > 0 && len(r.Weekdays) > 0 && !slices.Contains(r.Weekdays, start.Weekday()) {
+				if !start.Before(to) {
+					return
+				}
+				continue
+			}
+			if !emit(start) {
+				return
+			}
+		}
+	case FreqWeekly:
+		onDays := r.Weekdays
+		if len(onDays) == 0 {
+			onDays = []time.Weekday{first.Weekday()}
+		}
+		// the week DTSTART falls in, starting on WKST
+		weekStart := first.AddDate(0, 0, -((int(first.Weekday()) - int(r.WeekStart) + 7) % 7))
+		for weeks := 0; ; weeks += r.Interval {
+			for i := 0; i < 7; i++ {
+				start := at(weekStart.AddDate(0, 0, 7*weeks+i))
+				if start.Before(first) || (!start.Equal(first) && !slices.Contains(onDays, start.Weekday())) {
+					continue
+				}
+				if !emit(start) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// HELPER: check whether an occurrence starting at start, in the time zone of DTSTART, is removed by an EXDATE
+func (e BusyEvent) excluded(start time.Time) bool {
+	for _, exception := range e.Exceptions {
+		if exception.Equal(start) {
+			return true
+		}
+	}
+	for _, day := range e.ExceptionDays {
+		day = day.In(start.Location())
+		if day.Year() == start.Year() && day.YearDay() == start.YearDay() {
+			return true
+		}
+	}
+	return false
+}
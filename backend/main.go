@@ -4,6 +4,7 @@ import ( // Import for database connection
 	"database/sql"
 	"fmt"
 	"go-react-backend/routes" // Import for routes
+	"go-react-backend/workers"
 	"log"
 	"net/http"
 	"os"
@@ -25,16 +26,31 @@ func main() {
 		log.Fatalf("Error loading .env file: %w", err)
 	}
 
-	// connection pool to db
-	db, err := sql.Open("sqlite", "./bdatedata.db")
+	// connection pool to db, waiting for locks since matches are written in the background,
+	// and in WAL mode so requests can read while matches are being written
+	db, err := sql.Open("sqlite", "./bdatedata.db?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
 	if err != nil {
 		log.Fatalf("Failed to connect to SQLite: %w", err)
 	}
 	defer db.Close()
 
+	// Expire pending dates in the background
+	sweeper := workers.NewDateSweeper(db)
+	sweeper.Start()
+	defer sweeper.Stop()
+
+	// Recompute matches in the background
+	matchQueue := workers.NewMatchQueue(db)
+	matchQueue.Start()
+	defer matchQueue.Stop()
+
+	// Register routes that authenticate themselves (under subrouter v1/public, before the JWT protected routes)
+	publicRouter := r.PathPrefix("/api/v1/public").Subrouter()
+	routes.RegisterPublicRoutes(publicRouter, db)
+
 	// Register routes (under subrouter v1)
 	apiRouter := r.PathPrefix("/api/v1").Subrouter()
-	routes.RegisterRoutes(apiRouter, db)
+	routes.RegisterRoutes(apiRouter, db, matchQueue)
 
 	// Configure CORS (allowing the React frontend to communicate with the backend)
 	corsHandler := cors.New(cors.Options{
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"go-react-backend/contextkeys"
+)
+
+// middleware that only lets through users listed in ADMIN_USER_IDS (comma separated), must run after AuthMiddleware
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := r.Context().Value(contextkeys.UserIDKey).(string)
+
+		// read on every request so admins can be changed without a rebuild
+		for _, adminID := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+			if adminID = strings.TrimSpace(adminID); adminID != "" && adminID == userID {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		log.Printf("User %s is not an admin\n", userID)
+		http.Error(w, "Admin access required", http.StatusForbidden)
+	})
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"go-react-backend/contextkeys"
+	"go-react-backend/workers"
+)
+
+// Attach the match queue to a request's context
+func MatchQueueMiddleware(queue *workers.MatchQueue) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), contextkeys.MatchQueueContextKey, queue)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
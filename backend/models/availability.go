@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 )
 
 // Profile struct representing a user profile
@@ -145,52 +146,205 @@ func GetOverlapping(availability Availability, db *sql.DB) (*Availability, error
 	return &overlap, nil // overlap found
 }
 
-// Given a user, return a map of users who have overlapping availability with the provided user, and the corresponding Availabilities that are overlapping
+/*
+Given a user, return a map of users who have overlapping availability with the provided user, and the corresponding Availabilities that are overlapping.
+Users on either side of a block with the provided user are never returned.
+
+Every user's availability is read in their own time zone and compared in UTC, so overlaps can cross midnight or the end of the week.
+Overlaps are cut to the slot preferences of both users (the stricter minimum date length and granularity), and users whose overlaps are all too short are left out.
+The overlapping Availabilities are returned in UTC, use MergeAvailability to render them in another zone.
+*/
 func GetAllAvailable(userID string, db *sql.DB) (map[string][]Availability, error) {
 	overlappingAvailabilities := make(map[string][]Availability)
 
-	// Query availability table for entries that overlap
-	overlapQuery := `
-		SELECT 
-			a.user_id,
-			a.day_of_week,
-			CASE 
-				WHEN JULIANDAY(a.start_time) > JULIANDAY(b.start_time) THEN a.start_time 
-				ELSE b.start_time 
-			END AS overlap_start,
-			CASE 
-				WHEN JULIANDAY(a.end_time) < JULIANDAY(b.end_time) THEN a.end_time 
-				ELSE b.end_time 
-			END AS overlap_end
+	// Query every availability entry with the time zone of its owner, leaving out users blocked by or blocking userID
+	availabilityQuery := `
+		SELECT a.user_id, a.day_of_week, a.start_time, a.end_time, COALESCE(u.time_zone, '')
 		FROM availability a
-		JOIN availability b
-			ON a.day_of_week = b.day_of_week
-			AND JULIANDAY(a.start_time) < JULIANDAY(b.end_time)
-			AND JULIANDAY(a.end_time) > JULIANDAY(b.start_time)
-		WHERE b.user_id = ? 
-		AND a.user_id != b.user_id;
+		LEFT JOIN users u ON u.id = a.user_id
+		WHERE NOT EXISTS (
+			SELECT 1 FROM user_blocks b
+			WHERE (b.blocker_id = ? AND b.blocked_id = a.user_id) OR (b.blocker_id = a.user_id AND b.blocked_id = ?)
+		)
 	`
 
 	// query the db
-	overlapRows, err := db.Query(overlapQuery, userID)
+	rows, err := db.Query(availabilityQuery, userID, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get overlapping availability: %w", err)
 	}
-	defer overlapRows.Close()
+	defer rows.Close()
 
-	// append overlapping entries
-	for overlapRows.Next() {
+	// convert every entry to UTC week ranges, grouped by user
+	now := time.Now()
+	rangesByUser := make(map[string][]minuteRange)
+	for rows.Next() {
 		var availability Availability
+		var timeZone string
 
-		if err := overlapRows.Scan(&availability.UserID, &availability.DayOfWeek, &availability.StartTime, &availability.EndTime); err != nil {
-			return nil, fmt.Errorf("failed to scan overlapping user ID: %w", err)
+		if err := rows.Scan(&availability.UserID, &availability.DayOfWeek, &availability.StartTime, &availability.EndTime, &timeZone); err != nil {
+			return nil, fmt.Errorf("failed to scan availability: %w", err)
 		}
-		overlappingAvailabilities[availability.UserID] = append(overlappingAvailabilities[availability.UserID], availability) // Insert userId into map if its unique (struct{}{} is an empty value)
+		rangesByUser[availability.UserID] = append(rangesByUser[availability.UserID], weekRanges(availability, userLocation(timeZone), now)...)
 	}
 
-	if err := overlapRows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate over overlapping users: %w", err)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over availability: %w", err)
+	}
+
+	preferences, err := getSlotPreferences(nil, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// intersect the user's ranges with everyone else's
+	userRanges := rangesByUser[userID]
+	for otherUserID, otherRanges := range rangesByUser {
+		if otherUserID == userID {
+			continue
+		}
+		pairPreferences := combinePreferences(preferencesOf(preferences, userID), preferencesOf(preferences, otherUserID))
+		for _, overlap := range fitRanges(intersectRanges(userRanges, otherRanges), pairPreferences) {
+			overlappingAvailabilities[otherUserID] = append(overlappingAvailabilities[otherUserID], availabilityFromWeekRange(otherUserID, overlap, time.UTC, now)...)
+		}
 	}
 
 	return overlappingAvailabilities, nil
 }
+
+// AvailabilityChanges counts what ReplaceAvailability did to reach the desired schedule
+type AvailabilityChanges struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Deleted   int `json:"deleted"`
+	Unchanged int `json:"unchanged"`
+}
+
+/*
+ReplaceAvailability makes desired the complete weekly availability of userID, in a single transaction.
+desired is diffed against the current entries: identical entries are kept, leftover entries are reused for updates (same day first), and the rest is inserted or deleted.
+desired must already be validated and merged, see MergeWeeklySlots.
+*/
+func ReplaceAvailability(userID string, desired []Availability, db *sql.DB) (AvailabilityChanges, error) {
+	var changes AvailabilityChanges
+
+	tx, err := db.Begin()
+	if err != nil {
+		return changes, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, user_id, day_of_week, start_time, end_time FROM availability WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return changes, fmt.Errorf("failed to get current availability: %w", err)
+	}
+	var current []Availability
+	for rows.Next() {
+		var a Availability
+		if err := rows.Scan(&a.ID, &a.UserID, &a.DayOfWeek, &a.StartTime, &a.EndTime); err != nil {
+			rows.Close()
+			return changes, fmt.Errorf("failed to scan availability: %w", err)
+		}
+		current = append(current, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return changes, fmt.Errorf("failed to iterate over availability: %w", err)
+	}
+
+	// keep entries that are already there
+	var stale []Availability
+	missing := append([]Availability(nil), desired...)
+	for _, a := range current {
+		found := -1
+		for i, d := range missing {
+			if d.DayOfWeek == a.DayOfWeek && d.StartTime == a.StartTime && d.EndTime == a.EndTime {
+				found = i
+				break
+			}
+		}
+		if found == -1 {
+			stale = append(stale, a)
+			continue
+		}
+		missing = append(missing[:found], missing[found+1:]...)
+		changes.Unchanged++
+	}
+
+	// reuse stale entries for missing ones, preferring entries on the same day
+	for _, sameDay := range []bool{true, false} {
+		var stillMissing []Availability
+		for _, d := range missing {
+			reuse := -1
+			for i, a := range stale {
+				if !sameDay || a.DayOfWeek == d.DayOfWeek {
+					reuse = i
+					break
+				}
+			}
+			if reuse == -1 {
+				stillMissing = append(stillMissing, d)
+				continue
+			}
+
+			_, err := tx.Exec(`
+				UPDATE availability
+				SET day_of_week = ?, start_time = ?, end_time = ?
+				WHERE id = ? AND user_id = ?
+			`, d.DayOfWeek, d.StartTime, d.EndTime, stale[reuse].ID, userID)
+			if err != nil {
+				return changes, fmt.Errorf("failed to update availability: %w", err)
+			}
+			stale = append(stale[:reuse], stale[reuse+1:]...)
+			changes.Updated++
+		}
+		missing = stillMissing
+	}
+
+	for _, d := range missing {
+		_, err := tx.Exec(`
+			INSERT INTO availability (user_id, day_of_week, start_time, end_time)
+			VALUES (?, ?, ?, ?)
+		`, userID, d.DayOfWeek, d.StartTime, d.EndTime)
+		if err != nil {
+			return changes, fmt.Errorf("failed to insert availability: %w", err)
+		}
+		changes.Inserted++
+	}
+	for _, a := range stale {
+		_, err := tx.Exec("DELETE FROM availability WHERE id = ? AND user_id = ?", a.ID, userID)
+		if err != nil {
+			return changes, fmt.Errorf("failed to delete availability: %w", err)
+		}
+		changes.Deleted++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return changes, fmt.Errorf("failed to commit availability: %w", err)
+	}
+	return changes, nil
+}
+
+// MergeWeeklySlots merges the touching or overlapping timeslots of each day, returning them ordered from Monday to Sunday. Entries must be valid, see handlers.ValidateTimeslot.
+func MergeWeeklySlots(availabilities []Availability) []Availability {
+	rangesByDay := make(map[time.Weekday][]minuteRange)
+	for _, a := range availabilities {
+		weekday, _ := parseWeekday(a.DayOfWeek)
+		start, _ := parseClockMinutes(a.StartTime, false)
+		end, _ := parseClockMinutes(a.EndTime, true)
+		rangesByDay[weekday] = append(rangesByDay[weekday], minuteRange{start, end})
+	}
+
+	merged := []Availability{}
+	for i := 0; i < 7; i++ {
+		weekday := time.Weekday((int(time.Monday) + i) % 7)
+		for _, r := range mergeRanges(rangesByDay[weekday]) {
+			merged = append(merged, Availability{
+				DayOfWeek: weekday.String(),
+				StartTime: formatMinutes(r.start),
+				EndTime:   formatMinutes(r.end),
+			})
+		}
+	}
+	return merged
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// kinds of availability exceptions
+const (
+	ExceptionAdd    = "add"    // extra free time, e.g. "free this Saturday only"
+	ExceptionRemove = "remove" // blackout, e.g. "not available Dec 20 - Jan 5"
+)
+
+// AvailabilityException adds or removes a concrete range of time on top of a user's weekly availability
+type AvailabilityException struct {
+	ID     int    `json:"id"`
+	UserID string `json:"user_id"`
+	Kind   string `json:"kind"`
+	Start  string `json:"start"` // ISO 8601 format
+	End    string `json:"end"`   // ISO 8601 format
+	Reason string `json:"reason"`
+}
+
+// fetches the availability exceptions of userID, oldest first
+func GetAvailabilityExceptions(userID string, db *sql.DB) ([]AvailabilityException, error) {
+	rows, err := db.Query(`
+		SELECT id, user_id, kind, exception_start, exception_end, COALESCE(reason, '')
+		FROM availability_exceptions
+		WHERE user_id = ?
+		ORDER BY JULIANDAY(exception_start)
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get availability exceptions: %w", err)
+	}
+	defer rows.Close()
+
+	exceptions := []AvailabilityException{}
+	for rows.Next() {
+		var e AvailabilityException
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Kind, &e.Start, &e.End, &e.Reason); err != nil {
+			return nil, fmt.Errorf("failed to scan availability exception: %w", err)
+		}
+		exceptions = append(exceptions, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over availability exceptions: %w", err)
+	}
+	return exceptions, nil
+}
+
+// post an availability exception, returning its id
+func PostAvailabilityException(exception AvailabilityException, db *sql.DB) (int, error) {
+	result, err := db.Exec(`
+		INSERT INTO availability_exceptions (user_id, kind, exception_start, exception_end, reason)
+		VALUES (?, ?, ?, ?, ?)
+	`, exception.UserID, exception.Kind, exception.Start, exception.End, exception.Reason)
+	if err != nil {
+		return -1, fmt.Errorf("failed to insert availability exception: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return -1, fmt.Errorf("failed to fetch last insert id: %w", err)
+	}
+	return int(id), nil
+}
+
+// update an availability exception of exception.UserID
+func PutAvailabilityException(exception AvailabilityException, db *sql.DB) error {
+	result, err := db.Exec(`
+		UPDATE availability_exceptions
+		SET kind = ?, exception_start = ?, exception_end = ?, reason = ?
+		WHERE id = ? AND user_id = ?
+	`, exception.Kind, exception.Start, exception.End, exception.Reason, exception.ID, exception.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to update availability exception: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to fetch rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return errors.New("no rows were updated; ensure the ID and user ID match")
+	}
+	return nil
+}
+
+// delete an availability exception of userID
+func DeleteAvailabilityException(id int, userID string, db *sql.DB) error {
+	result, err := db.Exec("DELETE FROM availability_exceptions WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete availability exception: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to fetch affected rows: %w", err)
+	}
+	if rowsAffected == 0 {
+		return errors.New("no availability exception found to delete; ensure the ID corresponds to an entry for the current user")
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+/*
+Turning an imported iCalendar file into weekly availability: everything inside the daily window that the calendar does not mark as busy becomes a free timeslot
+*/
+
+package models
+
+import (
+	"fmt"
+	"go-react-backend/ical"
+	"sort"
+	"time"
+)
+
+const MINUTES_PER_DAY = 24 * 60
+
+// FreeWindowOptions controls how free windows are computed from a calendar
+type FreeWindowOptions struct {
+	Location   *time.Location // zone the weekly availability is expressed in
+	WeekStart  time.Time      // first day of the week whose busy time is used, weekly events repeat on top of it
+	DayStart   int            // minutes after midnight before which nobody is considered free
+	DayEnd     int            // minutes after midnight after which nobody is considered free
+	MinMinutes int            // shortest free window worth keeping
+}
+
+// minuteRange is a [start, end) range of minutes after midnight
+type minuteRange struct {
+	start int
+	end   int
+}
+
+/*
+FreeWindows computes the free timeslots of userID for every day of the week, given the busy time in calendar.
+
+Busy time is made of the occurrences of every event (single or repeating) and the busy periods inside of the week starting at opts.WeekStart.
+Every day's window [opts.DayStart, opts.DayEnd) minus the busy time of that day is free, as long as the free part is at least opts.MinMinutes long.
+
+Returns:
+
+	availabilities ordered from Monday to Sunday, in the same format as GetAvailability
+*/
+func FreeWindows(userID string, calendar *ical.Calendar, opts FreeWindowOptions) []Availability {
+	loc := opts.Location
+	weekStart := time.Date(opts.WeekStart.In(loc).Year(), opts.WeekStart.In(loc).Month(), opts.WeekStart.In(loc).Day(), 0, 0, 0, 0, loc)
+	weekEnd := weekStart.AddDate(0, 0, 7)
+
+	busy := make(map[time.Weekday][]minuteRange)
+	addBusy := func(start, end time.Time) {
+		if start.Before(weekStart) {
+			start = weekStart
+		}
+		if end.After(weekEnd) {
+			end = weekEnd
+		}
+		// split the busy block at every midnight it crosses
+		for start.Before(end) {
+			local := start.In(loc)
+			midnight := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc)
+			dayEnd := MINUTES_PER_DAY
+			if end.Before(midnight) {
+				localEnd := end.In(loc)
+				dayEnd = localEnd.Hour()*60 + localEnd.Minute()
+				if localEnd.Second() > 0 {
+					dayEnd++
+				}
+			}
+			busy[local.Weekday()] = append(busy[local.Weekday()], minuteRange{local.Hour()*60 + local.Minute(), dayEnd})
+			start = midnight
+		}
+	}
+
+	for _, event := range calendar.Events {
+		for _, occurrence := range event.Occurrences(weekStart, weekEnd) {
+			addBusy(occurrence.Start, occurrence.End)
+		}
+	}
+	for _, period := range calendar.Busy {
+		addBusy(period.Start, period.End)
+	}
+
+	var windows []Availability
+	for i := 0; i < 7; i++ {
+		weekday := time.Weekday((int(time.Monday) + i) % 7)
+		for _, free := range subtractRanges(minuteRange{opts.DayStart, opts.DayEnd}, busy[weekday]) {
+			if free.end-free.start < opts.MinMinutes {
+				continue
+			}
+			windows = append(windows, Availability{
+				UserID:    userID,
+				DayOfWeek: weekday.String(),
+				StartTime: formatMinutes(free.start),
+				EndTime:   formatMinutes(free.end),
+			})
+		}
+	}
+	return windows
+}
+
+// HELPER: remove every busy range from window, returning what is left in order
+func subtractRanges(window minuteRange, busy []minuteRange) []minuteRange {
+	sort.Slice(busy, func(i, j int) bool {
+		return busy[i].start < busy[j].start
+	})
+
+	var free []minuteRange
+	cursor := window.start
+	for _, b := range busy {
+		if b.end <= cursor || b.start >= window.end {
+			continue
+		}
+		if b.start > cursor {
+			free = append(free, minuteRange{cursor, b.start})
+		}
+		if b.end > cursor {
+			cursor = b.end
+		}
+	}
+	if cursor < window.end {
+		free = append(free, minuteRange{cursor, window.end})
+	}
+	return free
+}
+
+// HELPER: format minutes after midnight as HH:MM:SS, with the end of the day as 23:59:59
+func formatMinutes(minutes int) string {
+	if minutes >= MINUTES_PER_DAY {
+		return "23:59:59"
+	}
+	return fmt.Sprintf("%02d:%02d:00", minutes/60, minutes%60)
+}
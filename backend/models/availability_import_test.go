@@ -0,0 +1,104 @@
+package models
+
+import (
+	"go-react-backend/ical"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSubtractRanges(t *testing.T) {
+	window := minuteRange{9 * 60, 17 * 60}
+
+	tests := []struct {
+		name string
+		busy []minuteRange
+		want []minuteRange
+	}{
+		{"nothing busy", nil, []minuteRange{window}},
+		{"busy in the middle", []minuteRange{{600, 660}}, []minuteRange{{540, 600}, {660, 1020}}},
+		{"busy at both edges", []minuteRange{{480, 600}, {960, 1080}}, []minuteRange{{600, 960}}},
+		{"busy all day", []minuteRange{{0, 1440}}, nil},
+		{"busy outside of the window", []minuteRange{{0, 540}, {1020, 1440}}, []minuteRange{window}},
+		{"unsorted and overlapping", []minuteRange{{720, 780}, {600, 700}, {650, 730}}, []minuteRange{{540, 600}, {780, 1020}}},
+		{"one range inside another", []minuteRange{{600, 900}, {660, 720}}, []minuteRange{{540, 600}, {900, 1020}}},
+		{"touching ranges", []minuteRange{{600, 660}, {660, 720}}, []minuteRange{{540, 600}, {720, 1020}}},
+	}
+
+	for _, test := range tests {
+		if got := subtractRanges(window, test.busy); !slices.Equal(got, test.want) {
+			t.Errorf("%s: subtractRanges = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFreeWindows(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("loading time zone: %v", err)
+	}
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2025, month, day, hour, minute, 0, 0, la)
+	}
+	weekly := &ical.Recurrence{Frequency: ical.FreqWeekly, Interval: 1, WeekStart: time.Monday}
+
+	// the week of Monday March 3rd 2025
+	calendar := &ical.Calendar{
+		Events: []ical.BusyEvent{
+			{Period: ical.Period{Start: at(3, 3, 10, 0), End: at(3, 3, 11, 0)}},                  // Monday morning
+			{Period: ical.Period{Start: at(2, 19, 12, 0), End: at(2, 19, 13, 30)}, Rule: weekly}, // every Wednesday since February
+			{Period: ical.Period{Start: at(3, 6, 16, 0), End: at(3, 7, 10, 0)}},                  // Thursday afternoon to Friday morning
+			{Period: ical.Period{Start: at(3, 10, 9, 0), End: at(3, 10, 17, 0)}},                 // next week
+			{Period: ical.Period{Start: at(3, 8, 9, 0), End: at(3, 8, 9, 20).Add(30 * time.Second)}},
+		},
+		Busy: []ical.Period{
+			{Start: at(3, 4, 9, 0), End: at(3, 4, 16, 45)}, // leaves 15 minutes on Tuesday
+		},
+	}
+	opts := FreeWindowOptions{
+		Location:   la,
+		WeekStart:  at(3, 3, 15, 0), // any time in the week works
+		DayStart:   9 * 60,
+		DayEnd:     17 * 60,
+		MinMinutes: 30,
+	}
+
+	want := []Availability{
+		{DayOfWeek: "Monday", StartTime: "09:00:00", EndTime: "10:00:00"},
+		{DayOfWeek: "Monday", StartTime: "11:00:00", EndTime: "17:00:00"},
+		{DayOfWeek: "Wednesday", StartTime: "09:00:00", EndTime: "12:00:00"},
+		{DayOfWeek: "Wednesday", StartTime: "13:30:00", EndTime: "17:00:00"},
+		{DayOfWeek: "Thursday", StartTime: "09:00:00", EndTime: "16:00:00"},
+		{DayOfWeek: "Friday", StartTime: "10:00:00", EndTime: "17:00:00"},
+		{DayOfWeek: "Saturday", StartTime: "09:21:00", EndTime: "17:00:00"}, // a busy block ending mid-minute takes the whole minute
+		{DayOfWeek: "Sunday", StartTime: "09:00:00", EndTime: "17:00:00"},
+	}
+	for i := range want {
+		want[i].UserID = "user-1"
+	}
+
+	got := FreeWindows("user-1", calendar, opts)
+	if !slices.Equal(got, want) {
+		t.Errorf("FreeWindows =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestFreeWindowsWholeDay(t *testing.T) {
+	opts := FreeWindowOptions{
+		Location:  time.UTC,
+		WeekStart: time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC),
+		DayStart:  0,
+		DayEnd:    MINUTES_PER_DAY,
+	}
+
+	got := FreeWindows("user-1", &ical.Calendar{}, opts)
+	if len(got) != 7 {
+		t.Fatalf("got %d windows, want one per day: %v", len(got), got)
+	}
+	for i, window := range got {
+		weekday := time.Weekday((int(time.Monday) + i) % 7).String()
+		if window.DayOfWeek != weekday || window.StartTime != "00:00:00" || window.EndTime != "23:59:59" {
+			t.Errorf("window %d is %v, want %s from 00:00:00 to 23:59:59", i, window, weekday)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Blocks: users who never want to see each other. A block hides the pair from each other in both directions, whoever blocked.
+*/
+
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var ErrBlockNotFound = errors.New("block not found")
+
+// Block is a user blocked by the current user
+type Block struct {
+	BlockedID string `json:"user_id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+}
+
+/*
+Block blockedID for blockerID. Blocking twice is a no-op.
+The stored matches of the pair are removed, since they will not be matched again.
+*/
+func BlockUser(blockerID string, blockedID string, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO user_blocks (blocker_id, blocked_id)
+		VALUES (?, ?)
+		ON CONFLICT(blocker_id, blocked_id) DO NOTHING
+	`, blockerID, blockedID)
+	if err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+
+	if err := replacePairTx(blockerID, blockedID, nil, tx); err != nil {
+		return fmt.Errorf("failed to delete blocked matches: %w", err)
+	}
+	if err := replacePairTx(blockedID, blockerID, nil, tx); err != nil {
+		return fmt.Errorf("failed to delete blocked matches: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit block: %w", err)
+	}
+	return nil
+}
+
+// Remove the block blockerID placed on blockedID. Returns ErrBlockNotFound if there was none.
+func UnblockUser(blockerID string, blockedID string, db *sql.DB) error {
+	result, err := db.Exec(`DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?`, blockerID, blockedID)
+	if err != nil {
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to count unblocked users: %w", err)
+	}
+	if rows == 0 {
+		return ErrBlockNotFound
+	}
+	return nil
+}
+
+// Return the users blocked by userID, most recent first. Blocks placed on userID by others are not listed.
+func GetBlockedUsers(userID string, db *sql.DB) ([]Block, error) {
+	rows, err := db.Query(`
+		SELECT b.blocked_id, COALESCE(u.name, ''), b.created_at
+		FROM user_blocks b
+		LEFT JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = ?
+		ORDER BY b.created_at DESC, b.blocked_id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query blocked users: %w", err)
+	}
+	defer rows.Close()
+
+	blocks := []Block{}
+	for rows.Next() {
+		var block Block
+		if err := rows.Scan(&block.BlockedID, &block.Name, &block.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan blocked user: %w", err)
+		}
+		blocks = append(blocks, block)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating blocked users: %w", err)
+	}
+	return blocks, nil
+}
+
+// IsBlocked reports whether either user blocked the other
+func IsBlocked(user1ID string, user2ID string, db *sql.DB) (bool, error) {
+	var blocked bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)
+		)
+	`, user1ID, user2ID, user2ID, user1ID).Scan(&blocked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check block: %w", err)
+	}
+	return blocked, nil
+}
+
+// Return the set of users on the other side of a block with userID, in either direction
+func GetBlockedUserIDs(userID string, db *sql.DB) (map[string]bool, error) {
+	rows, err := db.Query(`
+		SELECT blocked_id FROM user_blocks WHERE blocker_id = ?
+		UNION
+		SELECT blocker_id FROM user_blocks WHERE blocked_id = ?
+	`, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query blocks: %w", err)
+	}
+	defer rows.Close()
+
+	blocked := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan block: %w", err)
+		}
+		blocked[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating blocks: %w", err)
+	}
+	return blocked, nil
+}
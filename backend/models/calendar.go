@@ -0,0 +1,54 @@
+/*
+Tokens that let calendar apps subscribe to a user's dates without a JWT
+*/
+
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidCalendarToken = errors.New("invalid calendar token")
+
+// RotateCalendarToken creates a new calendar feed token for userID, replacing any previous one
+func RotateCalendarToken(userID string, db *sql.DB) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate calendar token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	_, err := db.Exec(`
+		INSERT INTO calendar_tokens (user_id, token_hash)
+		VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET token_hash = excluded.token_hash, created_at = CURRENT_TIMESTAMP
+	`, userID, hashCalendarToken(token))
+	if err != nil {
+		return "", fmt.Errorf("failed to store calendar token: %w", err)
+	}
+
+	return token, nil
+}
+
+// GetUserIDByCalendarToken returns the user a calendar feed token belongs to, or ErrInvalidCalendarToken
+func GetUserIDByCalendarToken(token string, db *sql.DB) (string, error) {
+	var userID string
+	err := db.QueryRow("SELECT user_id FROM calendar_tokens WHERE token_hash = ?", hashCalendarToken(token)).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidCalendarToken
+	} else if err != nil {
+		return "", fmt.Errorf("failed to look up calendar token: %w", err)
+	}
+	return userID, nil
+}
+
+// HELPER: tokens are stored hashed, so a leaked database does not leak feed urls
+func hashCalendarToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
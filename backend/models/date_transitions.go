@@ -0,0 +1,284 @@
+/*
+Lifecycle of a scheduled date: which statuses a date can move between, and who is allowed to move it
+*/
+
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// statuses a scheduled date can be in
+const (
+	StatusPending     = "pending"
+	StatusConfirmed   = "confirmed"
+	StatusRejected    = "rejected"
+	StatusWithdrawn   = "withdrawn"
+	StatusExpired     = "expired"
+	StatusCancelled   = "cancelled"
+	StatusRescheduled = "rescheduled"
+)
+
+// DateRole is the part a user plays in a scheduled date
+type DateRole string
+
+const (
+	RoleProposer DateRole = "proposer" // user1_id, the user who asked for the date
+	RoleInvitee  DateRole = "invitee"  // user2_id, the user who was asked
+	RoleSystem   DateRole = "system"   // the server itself, e.g. the expiry sweeper
+)
+
+var (
+	ErrDateNotFound        = errors.New("scheduled date not found")
+	ErrNotParticipant      = errors.New("user is not a participant of this date")
+	ErrForbiddenTransition = errors.New("user is not allowed to make this status change")
+	ErrIllegalTransition   = errors.New("status change is not allowed from the current status")
+)
+
+/*
+dateTransitions maps current status -> new status -> the roles allowed to make that change.
+Any status that has no outgoing transitions is terminal.
+*/
+var dateTransitions = map[string]map[string][]DateRole{
+	StatusPending: {
+		StatusConfirmed: {RoleInvitee},
+		StatusRejected:  {RoleInvitee},
+		StatusWithdrawn: {RoleProposer},
+		StatusExpired:   {RoleSystem},
+	},
+	StatusConfirmed: {
+		StatusCancelled:   {RoleProposer, RoleInvitee},
+		StatusRescheduled: {RoleProposer, RoleInvitee},
+	},
+}
+
+// TransitionError describes why a status change was refused
+type TransitionError struct {
+	From string
+	To   string
+	Role DateRole
+	Err  error // one of ErrNotParticipant, ErrForbiddenTransition, ErrIllegalTransition
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot change date from %q to %q as %q: %v", e.From, e.To, e.Role, e.Err)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return e.Err
+}
+
+// DateRoleOf returns the role userID plays in date, or ErrNotParticipant
+func DateRoleOf(date *Date, userID string) (DateRole, error) {
+	switch userID {
+	case date.User1ID:
+		return RoleProposer, nil
+	case date.User2ID:
+		return RoleInvitee, nil
+	default:
+		return "", ErrNotParticipant
+	}
+}
+
+/*
+NegotiatingRoleOf returns the role userID plays in date when changing its status, or ErrNotParticipant.
+While a round of slots is open, whoever sent that round acts as the proposer and the other user as the invitee, so the users swap roles after every counter-proposal.
+open is the open round of the date, or nil if it has none, in which case user1_id is the proposer.
+*/
+func NegotiatingRoleOf(date *Date, open *Proposal, userID string) (DateRole, error) {
+	role, err := DateRoleOf(date, userID)
+	if err != nil || open == nil {
+		return role, err
+	}
+	if userID == open.ProposerID {
+		return RoleProposer, nil
+	}
+	return RoleInvitee, nil
+}
+
+// IsTerminalStatus reports whether a date in status can never change status again
+func IsTerminalStatus(status string) bool {
+	return len(dateTransitions[status]) == 0
+}
+
+// CheckDateTransition consults the transition table to see whether role may move a date from one status to another
+func CheckDateTransition(from, to string, role DateRole) error {
+	allowed, ok := dateTransitions[from][to]
+	if !ok {
+		return &TransitionError{From: from, To: to, Role: role, Err: ErrIllegalTransition}
+	}
+	for _, r := range allowed {
+		if r == role {
+			return nil
+		}
+	}
+	return &TransitionError{From: from, To: to, Role: role, Err: ErrForbiddenTransition}
+}
+
+/*
+TransitionDate moves date to the status to on behalf of userID, if the transition table allows it for the role userID plays (see NegotiatingRoleOf).
+A date that stops being pending has its open round closed in the same transaction.
+*/
+func TransitionDate(date *Date, userID string, to string, db *sql.DB) error {
+	open, err := GetOpenProposal(date.ID, db)
+	if err != nil && !errors.Is(err, ErrNoOpenProposal) {
+		return err
+	}
+	role, err := NegotiatingRoleOf(date, open, userID)
+	if err != nil {
+		return &TransitionError{From: date.Status, To: to, Err: err}
+	}
+	if err := CheckDateTransition(date.Status, to, role); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// only update if nobody changed the status in the meantime
+	if err := PatchDate(date.ID, date.Status, to, tx); err != nil {
+		return err
+	}
+	if err := closeOpenProposal(date.ID, tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit status change: %w", err)
+	}
+	date.Status = to
+	return nil
+}
+
+// CheckDateDeletion checks whether userID may delete date, whose open round is open (nil if none). Proposers can delete (withdraw) a pending date, and either participant can clear out a rejected or withdrawn date.
+// Confirmed dates cannot be deleted, and cancelled and rescheduled dates are kept as history.
+func CheckDateDeletion(date *Date, open *Proposal, userID string) error {
+	role, err := NegotiatingRoleOf(date, open, userID)
+	if err != nil {
+		return &TransitionError{From: date.Status, To: "deleted", Err: err}
+	}
+	if date.Status == StatusConfirmed || date.Status == StatusCancelled || date.Status == StatusRescheduled {
+		return &TransitionError{From: date.Status, To: "deleted", Role: role, Err: ErrIllegalTransition}
+	}
+	if IsTerminalStatus(date.Status) {
+		return nil
+	}
+	if err := CheckDateTransition(date.Status, StatusWithdrawn, role); err != nil {
+		var transitionErr *TransitionError
+		if errors.As(err, &transitionErr) {
+			transitionErr.To = "deleted"
+		}
+		return err
+	}
+	return nil
+}
+
+/*
+CancelDate cancels a confirmed date on behalf of userID, recording who cancelled it and why.
+The date itself is kept, and the user's cancellation count goes up by one.
+*/
+func CancelDate(date *Date, userID string, reason string, db *sql.DB) error {
+	role, err := DateRoleOf(date, userID)
+	if err != nil {
+		return &TransitionError{From: date.Status, To: StatusCancelled, Err: err}
+	}
+	if err := CheckDateTransition(date.Status, StatusCancelled, role); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := closeDate(date, StatusCancelled, userID, reason, tx); err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE users SET cancellation_count = cancellation_count + 1 WHERE id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("failed to update cancellation count: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit cancellation: %w", err)
+	}
+	return nil
+}
+
+/*
+RescheduleDate replaces a confirmed date with a new pending date at a different time, proposed by userID to the other participant.
+The original date is kept with status "rescheduled", and the new date links back to it through rescheduled_from.
+Rescheduling does not count towards the user's cancellation count.
+
+Returns:
+
+	id of the new pending date
+*/
+func RescheduleDate(date *Date, userID string, reason string, dateStart string, dateEnd string, db *sql.DB) (int, error) {
+	role, err := DateRoleOf(date, userID)
+	if err != nil {
+		return -1, &TransitionError{From: date.Status, To: StatusRescheduled, Err: err}
+	}
+	if err := CheckDateTransition(date.Status, StatusRescheduled, role); err != nil {
+		return -1, err
+	}
+
+	otherUserID := date.User2ID
+	if role == RoleInvitee {
+		otherUserID = date.User1ID
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return -1, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := closeDate(date, StatusRescheduled, userID, reason, tx); err != nil {
+		return -1, err
+	}
+	result, err := tx.Exec(`
+		INSERT INTO scheduled_dates (user1_id, user2_id, date_start, date_end, status, rescheduled_from)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, otherUserID, dateStart, dateEnd, StatusPending, date.ID)
+	if err != nil {
+		return -1, fmt.Errorf("failed to insert rescheduled date: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return -1, fmt.Errorf("failed to fetch last insert id: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("failed to commit reschedule: %w", err)
+	}
+	return int(id), nil
+}
+
+// HELPER: move a confirmed date to a cancelled status, recording who did it and why
+func closeDate(date *Date, status string, userID string, reason string, tx *sql.Tx) error {
+	result, err := tx.Exec(`
+		UPDATE scheduled_dates
+		SET status = ?, cancelled_by = ?, cancel_reason = ?, cancelled_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = ?
+	`, status, userID, reason, date.ID, date.Status)
+	if err != nil {
+		return fmt.Errorf("error updating status: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error fetching rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		// somebody changed the date in the meantime
+		return &TransitionError{From: date.Status, To: status, Err: ErrIllegalTransition}
+	}
+	return nil
+}
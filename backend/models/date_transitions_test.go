@@ -0,0 +1,158 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckDateTransition(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		role DateRole
+		want error // nil if the change is allowed
+	}{
+		{StatusPending, StatusConfirmed, RoleInvitee, nil},
+		{StatusPending, StatusConfirmed, RoleProposer, ErrForbiddenTransition},
+		{StatusPending, StatusRejected, RoleInvitee, nil},
+		{StatusPending, StatusRejected, RoleProposer, ErrForbiddenTransition},
+		{StatusPending, StatusWithdrawn, RoleProposer, nil},
+		{StatusPending, StatusWithdrawn, RoleInvitee, ErrForbiddenTransition},
+		{StatusPending, StatusExpired, RoleSystem, nil},
+		{StatusPending, StatusExpired, RoleInvitee, ErrForbiddenTransition},
+		{StatusPending, StatusCancelled, RoleProposer, ErrIllegalTransition},
+		{StatusConfirmed, StatusCancelled, RoleProposer, nil},
+		{StatusConfirmed, StatusCancelled, RoleInvitee, nil},
+		{StatusConfirmed, StatusRescheduled, RoleProposer, nil},
+		{StatusConfirmed, StatusRescheduled, RoleInvitee, nil},
+		{StatusConfirmed, StatusPending, RoleInvitee, ErrIllegalTransition},
+		{StatusConfirmed, StatusWithdrawn, RoleProposer, ErrIllegalTransition},
+		{StatusRejected, StatusConfirmed, RoleInvitee, ErrIllegalTransition},
+		{StatusWithdrawn, StatusPending, RoleProposer, ErrIllegalTransition},
+		{StatusExpired, StatusConfirmed, RoleInvitee, ErrIllegalTransition},
+		{StatusCancelled, StatusConfirmed, RoleInvitee, ErrIllegalTransition},
+		{StatusRescheduled, StatusConfirmed, RoleInvitee, ErrIllegalTransition},
+	}
+
+	for _, test := range tests {
+		err := CheckDateTransition(test.from, test.to, test.role)
+		if test.want == nil {
+			if err != nil {
+				t.Errorf("%s -> %s as %s: unexpected error %v", test.from, test.to, test.role, err)
+			}
+			continue
+		}
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s -> %s as %s: got %v, want %v", test.from, test.to, test.role, err, test.want)
+		}
+		var transitionErr *TransitionError
+		if !errors.As(err, &transitionErr) || transitionErr.From != test.from || transitionErr.To != test.to {
+			t.Errorf("%s -> %s as %s: got %#v, want a TransitionError for the change", test.from, test.to, test.role, err)
+		}
+	}
+}
+
+func TestIsTerminalStatus(t *testing.T) {
+	tests := map[string]bool{
+		StatusPending:     false,
+		StatusConfirmed:   false,
+		StatusRejected:    true,
+		StatusWithdrawn:   true,
+		StatusExpired:     true,
+		StatusCancelled:   true,
+		StatusRescheduled: true,
+	}
+
+	for status, want := range tests {
+		if got := IsTerminalStatus(status); got != want {
+			t.Errorf("IsTerminalStatus(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestCheckDateDeletion(t *testing.T) {
+	const proposer, invitee, stranger = "user-1", "user-2", "user-3"
+
+	tests := []struct {
+		status string
+		userID string
+		want   error // nil if the date can be deleted
+	}{
+		{StatusPending, proposer, nil},
+		{StatusPending, invitee, ErrForbiddenTransition},
+		{StatusPending, stranger, ErrNotParticipant},
+		{StatusConfirmed, proposer, ErrIllegalTransition},
+		{StatusConfirmed, invitee, ErrIllegalTransition},
+		{StatusRejected, proposer, nil},
+		{StatusRejected, invitee, nil},
+		{StatusWithdrawn, invitee, nil},
+		{StatusExpired, proposer, nil},
+		{StatusCancelled, proposer, ErrIllegalTransition},
+		{StatusRescheduled, invitee, ErrIllegalTransition},
+	}
+
+	for _, test := range tests {
+		date := &Date{ID: 1, User1ID: proposer, User2ID: invitee, Status: test.status}
+		err := CheckDateDeletion(date, nil, test.userID)
+		if test.want == nil {
+			if err != nil {
+				t.Errorf("deleting %s date as %s: unexpected error %v", test.status, test.userID, err)
+			}
+			continue
+		}
+		if !errors.Is(err, test.want) {
+			t.Errorf("deleting %s date as %s: got %v, want %v", test.status, test.userID, err, test.want)
+		}
+		var transitionErr *TransitionError
+		if errors.As(err, &transitionErr) && transitionErr.To != "deleted" {
+			t.Errorf("deleting %s date as %s: error reports the change to %q, want \"deleted\"", test.status, test.userID, transitionErr.To)
+		}
+	}
+}
+
+func TestDateRoleOf(t *testing.T) {
+	date := &Date{User1ID: "user-1", User2ID: "user-2"}
+
+	if role, err := DateRoleOf(date, "user-1"); err != nil || role != RoleProposer {
+		t.Errorf("DateRoleOf(user1) = %q, %v, want %q", role, err, RoleProposer)
+	}
+	if role, err := DateRoleOf(date, "user-2"); err != nil || role != RoleInvitee {
+		t.Errorf("DateRoleOf(user2) = %q, %v, want %q", role, err, RoleInvitee)
+	}
+	if _, err := DateRoleOf(date, "user-3"); !errors.Is(err, ErrNotParticipant) {
+		t.Errorf("DateRoleOf(stranger) error = %v, want %v", err, ErrNotParticipant)
+	}
+}
+
+func TestNegotiatingRoleOf(t *testing.T) {
+	date := &Date{User1ID: "user-1", User2ID: "user-2", Status: StatusPending}
+	countered := &Proposal{Round: 2, ProposerID: "user-2", Status: ProposalOpen}
+
+	tests := []struct {
+		open   *Proposal
+		userID string
+		want   DateRole
+	}{
+		{nil, "user-1", RoleProposer},
+		{nil, "user-2", RoleInvitee},
+		{countered, "user-1", RoleInvitee},
+		{countered, "user-2", RoleProposer},
+	}
+	for _, test := range tests {
+		role, err := NegotiatingRoleOf(date, test.open, test.userID)
+		if err != nil || role != test.want {
+			t.Errorf("NegotiatingRoleOf(%s, open round %v) = %q, %v, want %q", test.userID, test.open != nil, role, err, test.want)
+		}
+	}
+	if _, err := NegotiatingRoleOf(date, countered, "user-3"); !errors.Is(err, ErrNotParticipant) {
+		t.Errorf("NegotiatingRoleOf(stranger) error = %v, want %v", err, ErrNotParticipant)
+	}
+
+	// after a counter-proposal, only its sender can withdraw or delete the date, and only the other user can reject it
+	if err := CheckDateDeletion(date, countered, "user-1"); !errors.Is(err, ErrForbiddenTransition) {
+		t.Errorf("deleting a countered date as user1: error = %v, want %v", err, ErrForbiddenTransition)
+	}
+	if err := CheckDateDeletion(date, countered, "user-2"); err != nil {
+		t.Errorf("deleting a countered date as its sender: unexpected error %v", err)
+	}
+}
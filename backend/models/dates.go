@@ -3,6 +3,8 @@ package models
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 )
 
 // represent the scheduled_dates table
@@ -13,24 +15,51 @@ type Date struct {
 	DateStart string `json:"date_start"`
 	DateEnd   string `json:"date_end"`
 	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+
+	// set once a confirmed date is cancelled or rescheduled
+	CancelledBy  *string `json:"cancelled_by,omitempty"`
+	CancelReason *string `json:"cancel_reason,omitempty"`
+	CancelledAt  *string `json:"cancelled_at,omitempty"`
+
+	RescheduledFrom *int `json:"rescheduled_from,omitempty"` // id of the date this one replaces
+
+	Feedback *FeedbackSummary `json:"feedback,omitempty"` // only set when listing dates
+}
+
+// columns of scheduled_dates, in the order of Date.scanFields
+const dateColumns = "id, user1_id, user2_id, date_start, date_end, status, created_at, cancelled_by, cancel_reason, cancelled_at, rescheduled_from"
+
+// HELPER: pointers to the fields of a date, for scanning a row selected with dateColumns
+func (date *Date) scanFields() []interface{} {
+	return []interface{}{
+		&date.ID, &date.User1ID, &date.User2ID, &date.DateStart, &date.DateEnd, &date.Status, &date.CreatedAt,
+		&date.CancelledBy, &date.CancelReason, &date.CancelledAt, &date.RescheduledFrom,
+	}
+}
+
+// OtherUserID returns the user of the date who is not userID
+func (date Date) OtherUserID(userID string) string {
+	if date.User2ID == userID {
+		return date.User1ID
+	}
+	return date.User2ID
 }
 
 // GetDate gets a date by its ID
 func GetDate(id int, db *sql.DB) (*Date, error) {
 	query := `
-		SELECT id, user1_id, user2_id, date_start, date_end, status
+		SELECT ` + dateColumns + `
 		FROM scheduled_dates
 		WHERE id = ?
 	`
 
 	var date Date
 
-	err := db.QueryRow(query, id).Scan(
-		&date.ID, &date.User1ID, &date.User2ID, &date.DateStart, &date.DateEnd, &date.Status,
-	)
+	err := db.QueryRow(query, id).Scan(date.scanFields()...)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("scheduled date with id %d not found", id)
+			return nil, fmt.Errorf("scheduled date with id %d: %w", id, ErrDateNotFound)
 		}
 		return nil, fmt.Errorf("failed to retrieve scheduled date: %w", err)
 	}
@@ -43,16 +72,25 @@ func GetDates(userID string, status string, db *sql.DB) ([]Date, error) {
 	// build query with optional status
 	var query string
 	var params []interface{}
-	if IsValidStatus(status) {
+	if status == StatusPending {
+		// pending dates that already started are expired, even if the sweeper has not caught them yet
+		query = `
+			SELECT ` + dateColumns + `
+			FROM scheduled_dates
+			WHERE (user1_id = ? OR user2_id = ?) AND status = ?
+			AND JULIANDAY(date_start) > JULIANDAY('now')
+		`
+		params = []interface{}{userID, userID, status}
+	} else if IsValidStatus(status) {
 		query = `
-			SELECT id, user1_id, user2_id, date_start, date_end, status
+			SELECT ` + dateColumns + `
 			FROM scheduled_dates
 			WHERE (user1_id = ? OR user2_id = ?) AND status = ?
 		`
 		params = []interface{}{userID, userID, status}
 	} else {
 		query = `
-			SELECT id, user1_id, user2_id, date_start, date_end, status
+			SELECT ` + dateColumns + `
 			FROM scheduled_dates
 			WHERE user1_id = ? OR user2_id = ? 
 		`
@@ -71,7 +109,7 @@ func GetDates(userID string, status string, db *sql.DB) ([]Date, error) {
 		var date Date
 
 		// extract each row
-		err := rows.Scan(&date.ID, &date.User1ID, &date.User2ID, &date.DateStart, &date.DateEnd, &date.Status)
+		err := rows.Scan(date.scanFields()...)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning row: %w", err)
 		}
@@ -107,15 +145,16 @@ func PostDate(date Date, db *sql.DB) (int, error) {
 	return int(id), nil
 }
 
-func PatchDate(dateID int, status string, db *sql.DB) error {
+// PatchDate moves a date from status `from` to status `to`. Fails if the date is no longer in status `from`.
+func PatchDate(dateID int, from string, to string, tx *sql.Tx) error {
 	query := `
         UPDATE scheduled_dates
         SET status = ?
-        WHERE id = ?;
+        WHERE id = ? AND status = ?;
     `
 
 	// Execute the query with the provided dateID and newStatus
-	result, err := db.Exec(query, status, dateID)
+	result, err := tx.Exec(query, to, dateID, from)
 	if err != nil {
 		return fmt.Errorf("error updating status: %w", err)
 	}
@@ -127,7 +166,7 @@ func PatchDate(dateID int, status string, db *sql.DB) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("no rows updated, check if the dateID exists")
+		return &TransitionError{From: from, To: to, Err: ErrIllegalTransition}
 	}
 
 	return nil
@@ -153,14 +192,129 @@ func DeleteDate(dateID int, db *sql.DB) error {
 	return nil
 }
 
+/*
+GetConflictingDate finds a date that overlaps with the timeslot [dateStart, dateEnd) and involves either of the provided users.
+
+Params:
+
+	userIDs: users whose dates should be checked
+	statuses: only dates with one of these statuses count as a conflict
+	excludeID: a date id to ignore (e.g. the date being confirmed), or 0
+
+Returns:
+
+	the earliest conflicting date, or nil if there is none
+*/
+func GetConflictingDate(userIDs []string, dateStart string, dateEnd string, statuses []string, excludeID int, db *sql.DB) (*Date, error) {
+	if len(userIDs) == 0 || len(statuses) == 0 {
+		return nil, nil
+	}
+
+	userPlaceholders := strings.TrimSuffix(strings.Repeat("?,", len(userIDs)), ",")
+	statusPlaceholders := strings.TrimSuffix(strings.Repeat("?,", len(statuses)), ",")
+	query := fmt.Sprintf(`
+		SELECT `+dateColumns+`
+		FROM scheduled_dates
+		WHERE id != ?
+		AND status IN (%s)
+		AND (user1_id IN (%s) OR user2_id IN (%s))
+		AND JULIANDAY(date_start) < JULIANDAY(?)
+		AND JULIANDAY(date_end) > JULIANDAY(?)
+		ORDER BY JULIANDAY(date_start)
+		LIMIT 1
+	`, statusPlaceholders, userPlaceholders, userPlaceholders)
+
+	args := []interface{}{excludeID}
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+	for i := 0; i < 2; i++ {
+		for _, id := range userIDs {
+			args = append(args, id)
+		}
+	}
+	args = append(args, dateEnd, dateStart)
+
+	var conflict Date
+	err := db.QueryRow(query, args...).Scan(conflict.scanFields()...)
+	if err == sql.ErrNoRows {
+		return nil, nil // No conflict
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to check for conflicting dates: %w", err)
+	}
+
+	return &conflict, nil
+}
+
+/*
+ExpireStaleDates moves pending dates to "expired" once their start time has passed, or once they were created more than maxAge ago.
+The open rounds of the expired dates are closed in the same transaction.
+
+Params:
+
+	maxAge: how long a date can stay pending, 0 to only expire dates that already started
+	now: the current time
+
+Returns:
+
+	number of dates that were expired
+*/
+func ExpireStaleDates(maxAge time.Duration, now time.Time, db *sql.DB) (int64, error) {
+	query := `
+		UPDATE scheduled_dates
+		SET status = ?
+		WHERE status = ?
+		AND (JULIANDAY(date_start) <= JULIANDAY(?) OR (? AND JULIANDAY(created_at) <= JULIANDAY(?)))
+	`
+	deadline := now.Add(-maxAge)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, StatusExpired, StatusPending, now.UTC().Format(time.RFC3339), maxAge > 0, deadline.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire pending dates: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error fetching rows affected: %w", err)
+	}
+
+	// only pending dates can have an open round
+	_, err = tx.Exec(`
+		UPDATE date_proposals
+		SET status = ?
+		WHERE status = ? AND date_id IN (SELECT id FROM scheduled_dates WHERE status != ?)
+	`, ProposalClosed, ProposalOpen, StatusPending)
+	if err != nil {
+		return 0, fmt.Errorf("failed to close proposals of expired dates: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit expired dates: %w", err)
+	}
+	return rowsAffected, nil
+}
+
 // validate status
 func IsValidStatus(status string) bool {
 	switch status {
-	case "pending":
+	case StatusPending:
+		return true
+	case StatusConfirmed:
+		return true
+	case StatusRejected:
+		return true
+	case StatusWithdrawn:
+		return true
+	case StatusExpired:
 		return true
-	case "confirmed":
+	case StatusCancelled:
 		return true
-	case "rejected":
+	case StatusRescheduled:
 		return true
 	default:
 		return false
@@ -0,0 +1,265 @@
+/*
+Explanations of match scores: why two users were matched, question by question
+*/
+
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// answers this close to the same end of a question's scale (0 to 1) count as a shared interest
+const SHARED_INTEREST_MARGIN = 0.25
+
+// factors of a match score, see MatchExplanation.Factors
+const (
+	FactorQuizAgreement   = "quiz_agreement"
+	FactorSharedInterests = "shared_interests"
+	FactorAvailability    = "availability"
+)
+
+/*
+MatchExplanation breaks down the similarity score of a match, from the point of view of the current user (user1).
+The score only depends on the quiz: availability decides who is a match, but not how they rank.
+*/
+type MatchExplanation struct {
+	Metric            string              `json:"metric"`             // similarity metric the score was computed with
+	Score             float64             `json:"score"`              // score recomputed from the current answers, the sum of every contribution
+	YourSatisfaction  float64             `json:"your_satisfaction"`  // how well the other user's answers fit what the current user finds important
+	TheirSatisfaction float64             `json:"their_satisfaction"` // how well the current user's answers fit what the other user finds important
+	Questions         []QuestionAgreement `json:"questions"`
+	SharedInterests   []string            `json:"shared_interests"`         // label of the end of the scale both users answered at
+	OverlapMinutes    int                 `json:"overlap_minutes_per_week"` // weekly time both users are available
+	Factors           []ScoreFactor       `json:"factors"`
+}
+
+// QuestionAgreement is how both users answered one quiz question, and how much it adds to the score
+type QuestionAgreement struct {
+	Position        int     `json:"position"`
+	Prompt          string  `json:"prompt"`
+	YourAnswer      int     `json:"your_answer"`
+	TheirAnswer     int     `json:"their_answer"`
+	YourImportance  string  `json:"your_importance"`
+	TheirImportance string  `json:"their_importance"`
+	Agreement       float64 `json:"agreement"`    // 1 for the same answer, 0 for opposite ends of the scale
+	Contribution    float64 `json:"contribution"` // part of the score earned by this question
+	SharedInterest  bool    `json:"shared_interest"`
+}
+
+// ScoreFactor is the part of the score earned by one kind of evidence
+type ScoreFactor struct {
+	Factor       string  `json:"factor"`
+	Contribution float64 `json:"contribution"`
+}
+
+/*
+Fill in the Explanation of every match of userID, from the current answers and importance of both users and the stored weekly overlaps.
+Call it before the availabilities are converted out of UTC. Matches whose other user has no comparable vector, or answered another questionnaire version, are logged and left without one.
+*/
+func AttachMatchExplanations(matches []UserMatches, userID string, db *sql.DB) error {
+	if len(matches) == 0 {
+		return nil
+	}
+
+	otherIDs := make([]string, len(matches))
+	for i, match := range matches {
+		otherIDs[i] = match.OtherUserID(userID)
+	}
+	vectors, err := GetVectors(otherIDs, db)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve vectors: %w", err)
+	}
+	importances, err := GetImportances(otherIDs, db)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve importance: %w", err)
+	}
+	versions, err := GetQuestionnaireVersions(otherIDs, db)
+	if err != nil {
+		return err
+	}
+	currentUserVector, err := GetUserVector(userID, db)
+	if err != nil {
+		return err
+	}
+	currentUserImportance, err := GetUserImportance(userID, db)
+	if err != nil {
+		return err
+	}
+
+	// answers are compared on the scales of the questionnaire the current user answered, as in ComputeSimilarity
+	versionID, questionnaire, err := getUserQuestionnaire(userID, db)
+	if err != nil {
+		return err
+	}
+	var scales []AnswerScale
+	if questionnaire != nil {
+		if err := questionnaire.ValidateVector(currentUserVector); err != nil {
+			return fmt.Errorf("vector of current user ID %s cannot be explained: %w", userID, err)
+		}
+		scales = questionnaire.Scales()
+	}
+
+	metric := ConfiguredSimilarityMetric()
+	for i := range matches {
+		otherID := otherIDs[i]
+		vector, exists := vectors[otherID]
+		if !exists {
+			log.Printf("No vector to explain the match with %s\n", otherID)
+			continue
+		}
+		if versions[otherID] != versionID {
+			log.Printf("Cannot explain the match with %s: answered questionnaire version %d, not %d\n", otherID, versions[otherID], versionID)
+			continue
+		}
+		if questionnaire != nil {
+			if err := questionnaire.ValidateVector(vector); err != nil {
+				log.Printf("Cannot explain the match with %s: %v\n", otherID, err)
+				continue
+			}
+		}
+
+		explanation, err := ExplainSimilarity(metric, questionnaire, scales, currentUserVector, currentUserImportance, vector, importances[otherID])
+		if err != nil {
+			log.Printf("Cannot explain the match with %s: %v\n", otherID, err)
+			continue
+		}
+		explanation.OverlapMinutes = weeklyOverlapMinutes(matches[i].Availabilities)
+		matches[i].Explanation = explanation
+	}
+	return nil
+}
+
+/*
+ExplainSimilarity breaks down the MutualSimilarity of vec1 and vec2 per question. questionnaire may be nil, in which case questions have no prompt or labels.
+
+The score is the geometric mean of both satisfactions, so each satisfaction accounts for half of it.
+Each half is split between the questions in proportion to their weight (from importance) times their agreement, as the metric sees it.
+For the squared difference and manhattan metrics this is exactly how much each question adds to the satisfaction. For cosine and pearson it is an estimate.
+*/
+func ExplainSimilarity(metric SimilarityMetric, questionnaire *Questionnaire, scales []AnswerScale, vec1 []int, importance1 []string, vec2 []int, importance2 []string) (*MatchExplanation, error) {
+	answers1, answers2, _, err := normalizeAnswers(vec1, vec2, nil, scales)
+	if err != nil {
+		return nil, err
+	}
+	weights1 := ImportanceWeights(importance1, len(vec1))
+	weights2 := ImportanceWeights(importance2, len(vec2))
+
+	satisfaction1, err := metric.Score(vec1, vec2, weights1, scales)
+	if err != nil {
+		return nil, err
+	}
+	satisfaction2, err := metric.Score(vec2, vec1, weights2, scales)
+	if err != nil {
+		return nil, err
+	}
+	score := math.Sqrt(satisfaction1 * satisfaction2)
+
+	// agreement of each answer, as the metric counts it
+	agreements := make([]float64, len(answers1))
+	for i := range answers1 {
+		difference := math.Abs(answers1[i] - answers2[i])
+		if metric.Name() == MetricSquared {
+			agreements[i] = 1 - difference*difference
+		} else {
+			agreements[i] = 1 - difference
+		}
+	}
+	shares1 := questionShares(weights1, agreements)
+	shares2 := questionShares(weights2, agreements)
+
+	explanation := &MatchExplanation{
+		Metric:            metric.Name(),
+		Score:             score,
+		YourSatisfaction:  satisfaction1,
+		TheirSatisfaction: satisfaction2,
+		Questions:         make([]QuestionAgreement, len(vec1)),
+		SharedInterests:   []string{},
+	}
+	filled1 := FillImportance(importance1, len(vec1))
+	filled2 := FillImportance(importance2, len(vec2))
+	var interestScore float64
+	for i := range vec1 {
+		question := QuestionAgreement{
+			Position:        i,
+			YourAnswer:      vec1[i],
+			TheirAnswer:     vec2[i],
+			YourImportance:  filled1[i],
+			TheirImportance: filled2[i],
+			Agreement:       1 - math.Abs(answers1[i]-answers2[i]),
+			Contribution:    score * (shares1[i] + shares2[i]) / 2,
+		}
+
+		var label string
+		if questionnaire != nil {
+			question.Prompt = questionnaire.Questions[i].Prompt
+		}
+		switch {
+		case answers1[i] >= 1-SHARED_INTEREST_MARGIN && answers2[i] >= 1-SHARED_INTEREST_MARGIN:
+			question.SharedInterest = true
+			if questionnaire != nil {
+				label = questionnaire.Questions[i].MaxLabel
+			}
+		case answers1[i] <= SHARED_INTEREST_MARGIN && answers2[i] <= SHARED_INTEREST_MARGIN:
+			question.SharedInterest = true
+			if questionnaire != nil {
+				label = questionnaire.Questions[i].MinLabel
+			}
+		}
+		if question.SharedInterest {
+			if label == "" {
+				label = fmt.Sprintf("question %d", i+1)
+			}
+			explanation.SharedInterests = append(explanation.SharedInterests, label)
+			interestScore += question.Contribution
+		}
+
+		explanation.Questions[i] = question
+	}
+
+	explanation.Factors = []ScoreFactor{
+		{Factor: FactorQuizAgreement, Contribution: score - interestScore},
+		{Factor: FactorSharedInterests, Contribution: interestScore},
+		{Factor: FactorAvailability, Contribution: 0}, // overlaps decide who is a match, not the score
+	}
+	return explanation, nil
+}
+
+// HELPER: share of a satisfaction earned by each question: weight times agreement, falling back to the weights alone, or equal shares, when those sum to 0
+func questionShares(weights []float64, agreements []float64) []float64 {
+	shares := make([]float64, len(weights))
+	var total, totalWeight float64
+	for i := range weights {
+		total += weights[i] * agreements[i]
+		totalWeight += weights[i]
+	}
+
+	for i := range shares {
+		switch {
+		case total > 0:
+			shares[i] = weights[i] * agreements[i] / total
+		case totalWeight > 0:
+			shares[i] = weights[i] / totalWeight
+		default:
+			shares[i] = 1 / float64(len(shares))
+		}
+	}
+	return shares
+}
+
+// HELPER: minutes per week covered by weekly availabilities in UTC, counting overlapping entries once
+func weeklyOverlapMinutes(availabilities []Availability) int {
+	var ranges []minuteRange
+	for _, availability := range availabilities {
+		ranges = append(ranges, weekRanges(availability, time.UTC, time.Now())...)
+	}
+
+	minutes := 0
+	for _, r := range mergeRanges(ranges) {
+		minutes += r.end - r.start
+	}
+	return minutes
+}
@@ -0,0 +1,136 @@
+/*
+Feedback participants leave after a confirmed date has ended
+*/
+
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDateNotConfirmed = errors.New("feedback can only be left for confirmed dates")
+	ErrDateNotEnded     = errors.New("feedback can only be left once the date has ended")
+	ErrFeedbackExists   = errors.New("feedback was already submitted for this date")
+)
+
+// represent the date_feedback table
+type Feedback struct {
+	ID             int    `json:"id"`
+	DateID         int    `json:"date_id"`
+	UserID         string `json:"user_id"`
+	Rating         int    `json:"rating"`
+	WouldMeetAgain bool   `json:"would_meet_again"`
+	Notes          string `json:"notes"`
+	CreatedAt      string `json:"created_at"`
+}
+
+/*
+aggregated feedback for a date, as shown to one of its participants (notes are never included).
+Ratings are left out: with two participants, any aggregate next to the viewer's own rating gives away the other's.
+*/
+type FeedbackSummary struct {
+	Count           int  `json:"count"`             // how many participants left feedback (0 to 2)
+	MutualMeetAgain bool `json:"mutual_meet_again"` // true once both participants said they would meet again
+	SubmittedByMe   bool `json:"submitted_by_me"`   // whether the viewer already left feedback
+}
+
+/*
+PostFeedback stores feedback by a participant of date. The date has to be confirmed and already over, and each participant can only leave feedback once.
+
+Returns:
+
+	id of the new feedback
+*/
+func PostFeedback(date *Date, feedback Feedback, now time.Time, db *sql.DB) (int, error) {
+	if _, err := DateRoleOf(date, feedback.UserID); err != nil {
+		return -1, err
+	}
+	if date.Status != StatusConfirmed {
+		return -1, ErrDateNotConfirmed
+	}
+	end, err := time.Parse(time.RFC3339, date.DateEnd)
+	if err != nil {
+		return -1, fmt.Errorf("invalid date_end stored for date %d: %w", date.ID, err)
+	}
+	if now.Before(end) {
+		return -1, ErrDateNotEnded
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO date_feedback (date_id, user_id, rating, would_meet_again, notes)
+		VALUES (?, ?, ?, ?, ?)
+	`, date.ID, feedback.UserID, feedback.Rating, feedback.WouldMeetAgain, feedback.Notes)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return -1, ErrFeedbackExists
+		}
+		return -1, fmt.Errorf("failed to insert feedback: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return -1, fmt.Errorf("failed to fetch last insert id: %w", err)
+	}
+	return int(id), nil
+}
+
+// AttachFeedbackSummaries sets the aggregated feedback of every date, as seen by viewerID. Dates without feedback get an empty summary.
+func AttachFeedbackSummaries(dates []Date, viewerID string, db *sql.DB) error {
+	if len(dates) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(dates))
+	args := make([]interface{}, len(dates))
+	summaries := make(map[int]*FeedbackSummary)
+	for i := range dates {
+		placeholders[i] = "?"
+		args[i] = dates[i].ID
+		summaries[dates[i].ID] = &FeedbackSummary{}
+	}
+
+	query := fmt.Sprintf(
+		"SELECT date_id, user_id, would_meet_again FROM date_feedback WHERE date_id IN (%s)",
+		strings.Join(placeholders, ","),
+	)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query feedback: %w", err)
+	}
+	defer rows.Close()
+
+	// count feedback per date
+	meetAgain := make(map[int]int)
+	for rows.Next() {
+		var dateID int
+		var userID string
+		var wouldMeetAgain bool
+		if err := rows.Scan(&dateID, &userID, &wouldMeetAgain); err != nil {
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+
+		summary := summaries[dateID]
+		summary.Count++
+		if wouldMeetAgain {
+			meetAgain[dateID]++
+		}
+		if userID == viewerID {
+			summary.SubmittedByMe = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	for i := range dates {
+		summary := summaries[dates[i].ID]
+		summary.MutualMeetAgain = meetAgain[dates[i].ID] == 2
+		dates[i].Feedback = summary
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+/*
+How much each quiz answer matters to a user, and how that turns into weights for the similarity metrics
+*/
+
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// how important a quiz question is to the user who answered it
+const (
+	ImportanceIrrelevant = "irrelevant"
+	ImportanceLittle     = "a little"
+	ImportanceVery       = "very"
+	ImportanceMandatory  = "mandatory"
+)
+
+// questions without a declared importance count as "a little", so every answer counts equally until a user says otherwise
+const DEFAULT_IMPORTANCE = ImportanceLittle
+
+// a mandatory answer is missed when the other user's answer is further away than this fraction of the question's answer scale (1 step on a 1 to 5 scale)
+const MANDATORY_MAX_DIFFERENCE = 0.25
+
+// weight of an answer in the similarity score for each importance, following OkCupid's steep scale
+var IMPORTANCE_WEIGHTS = map[string]float64{
+	ImportanceIrrelevant: 0,
+	ImportanceLittle:     1,
+	ImportanceVery:       50,
+	ImportanceMandatory:  250,
+}
+
+var ErrInvalidImportance = errors.New("invalid importance")
+
+// ValidateImportance checks that importance has one known value for each of the n quiz answers
+func ValidateImportance(importance []string, n int) error {
+	if len(importance) != n {
+		return fmt.Errorf("%w: expected %d values, got %d", ErrInvalidImportance, n, len(importance))
+	}
+	for i, value := range importance {
+		if _, ok := IMPORTANCE_WEIGHTS[value]; !ok {
+			return fmt.Errorf("%w: %q for question %d", ErrInvalidImportance, value, i+1)
+		}
+	}
+	return nil
+}
+
+// FillImportance returns the importance of each of the n quiz answers, using the default for anything missing or stored for a different quiz length
+func FillImportance(importance []string, n int) []string {
+	if ValidateImportance(importance, n) == nil {
+		return importance
+	}
+	filled := make([]string, n)
+	for i := range filled {
+		filled[i] = DEFAULT_IMPORTANCE
+	}
+	return filled
+}
+
+// ImportanceWeights turns the importance of each of the n quiz answers into weights for a SimilarityMetric
+func ImportanceWeights(importance []string, n int) []float64 {
+	weights := make([]float64, n)
+	for i, value := range FillImportance(importance, n) {
+		weights[i] = IMPORTANCE_WEIGHTS[value]
+	}
+	return weights
+}
+
+/*
+MandatoryMismatch reports whether answers is too far from any answer in vec1 that importance1 marks as mandatory.
+The distance is measured relative to each question's scale, like the similarity metrics do. nil scales use DEFAULT_ANSWER_SCALE for every answer.
+*/
+func MandatoryMismatch(scales []AnswerScale, vec1 []int, importance1 []string, answers []int) bool {
+	if len(answers) != len(vec1) {
+		return false
+	}
+	for i, value := range FillImportance(importance1, len(vec1)) {
+		if value != ImportanceMandatory {
+			continue
+		}
+		scale := DEFAULT_ANSWER_SCALE
+		if len(scales) == len(vec1) {
+			scale = scales[i]
+		}
+		difference := math.Abs(float64(vec1[i] - answers[i]))
+		if difference > MANDATORY_MAX_DIFFERENCE*float64(scale.Max-scale.Min) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the importance the user declared for each quiz answer, or nil if they never declared any
+func GetUserImportance(userID string, db *sql.DB) ([]string, error) {
+	var importanceJSON sql.NullString
+	err := db.QueryRow("SELECT importance FROM users WHERE id = ?", userID).Scan(&importanceJSON)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("no importance found for user: %w", err)
+		}
+		return nil, fmt.Errorf("error querying user importance: %w", err)
+	}
+
+	return parseImportance(importanceJSON)
+}
+
+// Get the declared importance for a list of users, given their userIDs. Users who never declared any are left out.
+func GetImportances(userIDs []string, db *sql.DB) (map[string][]string, error) {
+	importances := make(map[string][]string)
+	if len(userIDs) == 0 {
+		return importances, nil
+	}
+
+	placeholders := make([]string, len(userIDs))
+	args := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	query := fmt.Sprintf(
+		"SELECT id, importance FROM users WHERE importance IS NOT NULL AND id IN (%s)",
+		strings.Join(placeholders, ","),
+	)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user importance: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		var importanceJSON sql.NullString
+		if err := rows.Scan(&userID, &importanceJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		importance, err := parseImportance(importanceJSON)
+		if err != nil {
+			return nil, err
+		}
+		importances[userID] = importance
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user importance: %w", err)
+	}
+
+	return importances, nil
+}
+
+// HELPER: decode the importance column, which is NULL until the user declares it
+func parseImportance(importanceJSON sql.NullString) ([]string, error) {
+	if !importanceJSON.Valid || importanceJSON.String == "" {
+		return nil, nil
+	}
+
+	var importance []string
+	if err := json.Unmarshal([]byte(importanceJSON.String), &importance); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal importance JSON: %w", err)
+	}
+	return importance, nil
+}
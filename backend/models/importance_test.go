@@ -0,0 +1,34 @@
+package models
+
+import "testing"
+
+func TestMandatoryMismatch(t *testing.T) {
+	mandatory := []string{ImportanceMandatory}
+
+	tests := []struct {
+		name     string
+		scales   []AnswerScale
+		answer   int
+		other    int
+		mismatch bool
+	}{
+		{"default scale allows 1 step", nil, 3, 4, false},
+		{"default scale misses 2 steps", nil, 3, 5, true},
+		{"1 to 3 scale needs the same answer", []AnswerScale{{1, 3}}, 2, 3, true},
+		{"1 to 3 scale, same answer", []AnswerScale{{1, 3}}, 2, 2, false},
+		{"0 to 10 scale allows 2 steps", []AnswerScale{{0, 10}}, 5, 7, false},
+		{"0 to 10 scale misses 3 steps", []AnswerScale{{0, 10}}, 5, 8, true},
+	}
+
+	for _, test := range tests {
+		got := MandatoryMismatch(test.scales, []int{test.answer}, mandatory, []int{test.other})
+		if got != test.mismatch {
+			t.Errorf("%s: MandatoryMismatch(%d, %d) = %v, want %v", test.name, test.answer, test.other, got, test.mismatch)
+		}
+	}
+
+	// answers that are not mandatory never miss
+	if MandatoryMismatch(nil, []int{1}, []string{ImportanceVery}, []int{5}) {
+		t.Error("MandatoryMismatch of an answer marked \"very\" = true, want false")
+	}
+}
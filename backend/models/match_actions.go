@@ -0,0 +1,145 @@
+/*
+Likes and passes: what a user thinks of a match. Passed pairs are never matched again, and a pair who liked each other is a mutual match.
+*/
+
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// actions a user can take on a match
+const (
+	ActionLike = "like"
+	ActionPass = "pass"
+)
+
+// environment variable that, when true, only lets users invite people they mutually liked to a date
+const REQUIRE_MUTUAL_LIKE_FOR_DATES_ENV = "REQUIRE_MUTUAL_LIKE_FOR_DATES"
+
+// MutualLikeRequiredForDates reports whether REQUIRE_MUTUAL_LIKE_FOR_DATES is turned on (off when unset or invalid)
+func MutualLikeRequiredForDates() bool {
+	required, err := strconv.ParseBool(os.Getenv(REQUIRE_MUTUAL_LIKE_FOR_DATES_ENV))
+	return err == nil && required
+}
+
+/*
+Record that userID liked or passed targetID, replacing any earlier action on them.
+Passing also removes the stored matches of the pair, since they will not be matched again.
+
+Returns:
+
+	mutual bool
+		true if both users now like each other
+*/
+func RecordMatchAction(userID string, targetID string, action string, db *sql.DB) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO match_actions (user_id, target_id, action)
+		VALUES (?, ?, ?)
+		ON CONFLICT(user_id, target_id) DO UPDATE SET action = excluded.action, created_at = CURRENT_TIMESTAMP
+	`, userID, targetID, action)
+	if err != nil {
+		return false, fmt.Errorf("failed to record match action: %w", err)
+	}
+
+	if action == ActionPass {
+		if err := replacePairTx(userID, targetID, nil, tx); err != nil {
+			return false, fmt.Errorf("failed to delete passed matches: %w", err)
+		}
+		if err := replacePairTx(targetID, userID, nil, tx); err != nil {
+			return false, fmt.Errorf("failed to delete passed matches: %w", err)
+		}
+	}
+
+	mutual, err := isMutualLike(userID, targetID, tx)
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit match action: %w", err)
+	}
+	return mutual, nil
+}
+
+// IsMutualLike reports whether both users liked each other
+func IsMutualLike(user1ID string, user2ID string, db *sql.DB) (bool, error) {
+	return isMutualLike(user1ID, user2ID, db)
+}
+
+/*
+Fill in "liked" and "mutual" on each match: whether userID liked the other user, and whether the other user liked them back.
+Who liked the current user is only revealed through a mutual like.
+*/
+func AttachMatchActions(matches []UserMatches, userID string, db *sql.DB) error {
+	if len(matches) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(matches))
+	args := []interface{}{userID}
+	for i, match := range matches {
+		placeholders[i] = "?"
+		args = append(args, match.OtherUserID(userID))
+	}
+
+	// users the current user liked, and whether they liked back
+	query := fmt.Sprintf(`
+		SELECT mine.target_id, theirs.user_id IS NOT NULL
+		FROM match_actions mine
+		LEFT JOIN match_actions theirs
+			ON theirs.user_id = mine.target_id AND theirs.target_id = mine.user_id AND theirs.action = 'like'
+		WHERE mine.user_id = ? AND mine.action = 'like' AND mine.target_id IN (%s)
+	`, strings.Join(placeholders, ","))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query match actions: %w", err)
+	}
+	defer rows.Close()
+
+	mutual := make(map[string]bool)
+	for rows.Next() {
+		var targetID string
+		var likedBack bool
+		if err := rows.Scan(&targetID, &likedBack); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		mutual[targetID] = likedBack
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating match actions: %w", err)
+	}
+
+	for i := range matches {
+		likedBack, liked := mutual[matches[i].OtherUserID(userID)]
+		matches[i].Liked = liked
+		matches[i].Mutual = likedBack
+	}
+	return nil
+}
+
+// HELPER: whether both users liked each other, inside or outside of a transaction
+func isMutualLike(user1ID string, user2ID string, db interface {
+	QueryRow(string, ...any) *sql.Row
+}) (bool, error) {
+	var likes int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM match_actions
+		WHERE action = 'like' AND ((user_id = ? AND target_id = ?) OR (user_id = ? AND target_id = ?))
+	`, user1ID, user2ID, user2ID, user1ID).Scan(&likes)
+	if err != nil {
+		return false, fmt.Errorf("failed to query likes: %w", err)
+	}
+	return likes == 2, nil
+}
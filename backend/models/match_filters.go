@@ -0,0 +1,140 @@
+/*
+Dealbreaker filters: who a user is willing to be matched with. Filters are mutual, so two users are only matched if each passes the other's filters.
+*/
+
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// genders a user can give in their profile, and ask for in seeking
+var GENDERS = []string{"woman", "man", "nonbinary"}
+
+// youngest age a user can be, or filter for
+const MIN_AGE = 18
+
+// MatchFilters are the limits a user sets on the age and class year of their matches. A nil limit means no limit.
+type MatchFilters struct {
+	MinAge       *int `json:"min_age"`
+	MaxAge       *int `json:"max_age"`
+	MinClassYear *int `json:"min_class_year"`
+	MaxClassYear *int `json:"max_class_year"`
+}
+
+// Return the filters of a user, with no limits if they never set any
+func GetMatchFilters(userID string, db *sql.DB) (MatchFilters, error) {
+	var filters MatchFilters
+	err := db.QueryRow(`
+		SELECT min_age, max_age, min_class_year, max_class_year
+		FROM match_filters
+		WHERE user_id = ?
+	`, userID).Scan(&filters.MinAge, &filters.MaxAge, &filters.MinClassYear, &filters.MaxClassYear)
+	if err != nil && err != sql.ErrNoRows {
+		return MatchFilters{}, fmt.Errorf("error querying match filters: %w", err)
+	}
+	return filters, nil
+}
+
+// Replace the filters of a user
+func PutMatchFilters(userID string, filters MatchFilters, db *sql.DB) error {
+	_, err := db.Exec(`
+		INSERT INTO match_filters (user_id, min_age, max_age, min_class_year, max_class_year)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			min_age = excluded.min_age,
+			max_age = excluded.max_age,
+			min_class_year = excluded.min_class_year,
+			max_class_year = excluded.max_class_year
+	`, userID, filters.MinAge, filters.MaxAge, filters.MinClassYear, filters.MaxClassYear)
+	if err != nil {
+		return fmt.Errorf("failed to update match filters: %w", err)
+	}
+	return nil
+}
+
+/*
+Narrow candidates down to the users who are mutually compatible with userID: each one's gender is one the other is seeking, and each one's age and class year pass the other's filters.
+Pairs where either user passed on or blocked the other are left out too.
+This runs in SQL so incompatible users are never scored.
+
+Params:
+
+	userID string
+	candidates []string
+
+Returns:
+
+	[]string
+		the compatible candidates, in no particular order
+*/
+func GetCompatibleUsers(userID string, candidates []string, db *sql.DB) ([]string, error) {
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, len(candidates)) // query placeholder values
+	args := make([]interface{}, 0, len(candidates)+1)
+	for i, id := range candidates {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+	args = append(args, userID)
+
+	// a NULL age or class year compares as unknown, so it never passes a limit
+	query := fmt.Sprintf(`
+		WITH people AS (
+			SELECT id, gender, seeking, class_year,
+				CAST(strftime('%%Y', 'now') AS INTEGER) - CAST(strftime('%%Y', birth_date) AS INTEGER)
+					- (strftime('%%m-%%d', 'now') < strftime('%%m-%%d', birth_date)) AS age
+			FROM users
+		)
+		SELECT c.id
+		FROM people u
+		JOIN people c ON c.id IN (%s) AND c.id != u.id
+		LEFT JOIN match_filters uf ON uf.user_id = u.id
+		LEFT JOIN match_filters cf ON cf.user_id = c.id
+		WHERE u.id = ?
+			AND (COALESCE(json_array_length(u.seeking), 0) = 0 OR EXISTS (SELECT 1 FROM json_each(u.seeking) WHERE value = c.gender))
+			AND (COALESCE(json_array_length(c.seeking), 0) = 0 OR EXISTS (SELECT 1 FROM json_each(c.seeking) WHERE value = u.gender))
+			AND (uf.min_age IS NULL OR c.age >= uf.min_age)
+			AND (uf.max_age IS NULL OR c.age <= uf.max_age)
+			AND (cf.min_age IS NULL OR u.age >= cf.min_age)
+			AND (cf.max_age IS NULL OR u.age <= cf.max_age)
+			AND (uf.min_class_year IS NULL OR c.class_year >= uf.min_class_year)
+			AND (uf.max_class_year IS NULL OR c.class_year <= uf.max_class_year)
+			AND (cf.min_class_year IS NULL OR u.class_year >= cf.min_class_year)
+			AND (cf.max_class_year IS NULL OR u.class_year <= cf.max_class_year)
+			AND NOT EXISTS (
+				SELECT 1 FROM match_actions a
+				WHERE a.action = 'pass'
+					AND ((a.user_id = u.id AND a.target_id = c.id) OR (a.user_id = c.id AND a.target_id = u.id))
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = u.id AND b.blocked_id = c.id) OR (b.blocker_id = c.id AND b.blocked_id = u.id)
+			)
+	`, strings.Join(placeholders, ","))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query compatible users: %w", err)
+	}
+	defer rows.Close()
+
+	var compatible []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		compatible = append(compatible, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating compatible users: %w", err)
+	}
+
+	return compatible, nil
+}
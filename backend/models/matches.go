@@ -1,13 +1,26 @@
 package models
 
 import (
+	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// most users stored per user in the matches table
 const BATCH_SIZE = 50
 
+// stored matches are rebuilt when read after this long, in case a change that should have updated them was missed
+const MATCHES_MAX_AGE = 24 * time.Hour
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+var ErrMatchNotFound = errors.New("match not found")
+
 type Match struct {
 	ID         int     `json:"id"`
 	User1ID    string  `json:"user1_id"`
@@ -19,10 +32,22 @@ type Match struct {
 }
 
 type UserMatches struct {
-	User1ID        string         `json:"user1_id"`
-	User2ID        string         `json:"user2_id"`
-	Similarity     float64        `json:"similarity_score"`
-	Availabilities []Availability `json:"availabilities"`
+	User1ID        string            `json:"user1_id"`
+	User2ID        string            `json:"user2_id"`
+	Similarity     float64           `json:"similarity_score"`
+	Availabilities []Availability    `json:"availabilities"`
+	UpcomingSlots  []Slot            `json:"upcoming_slots,omitempty"` // concrete times when both users are free, exceptions included
+	Liked          bool              `json:"liked"`                    // the current user liked the other user, filled in by AttachMatchActions
+	Mutual         bool              `json:"mutual"`                   // both users liked each other, filled in by AttachMatchActions
+	Explanation    *MatchExplanation `json:"explanation,omitempty"`    // breakdown of the similarity score, filled in by AttachMatchExplanations
+}
+
+// OtherUserID returns the user of the match who is not userID
+func (m UserMatches) OtherUserID(userID string) string {
+	if m.User2ID == userID {
+		return m.User1ID
+	}
+	return m.User2ID
 }
 
 // Compute all matches for a user, based on their availability and with an associated similarity score
@@ -34,25 +59,42 @@ func ComputeMatches(userID string, db *sql.DB) ([]UserMatches, error) {
 		return nil, err
 	}
 
+	// Honor availability exceptions: only users with an upcoming concrete overlap are matches.
+	// This drops users hidden by a blackout, and adds users who only overlap through extra free time.
+	now := time.Now()
+	upcomingSlots, err := GetUpcomingOverlaps(userID, now, now.AddDate(0, 0, 7*UPCOMING_WEEKS), db)
+	if err != nil {
+		return nil, err
+	}
+
 	// extract users
 	var users []string
-	for key := range userAvailabilities {
+	for key := range upcomingSlots {
 		users = append(users, key)
 	}
 
+	// only score users who pass each other's filters
+	users, err = GetCompatibleUsers(userID, users, db)
+	if err != nil {
+		return nil, err
+	}
+
 	// Step 2: Compute similarities
 	similarityScores, err := ComputeSimilarity(users, userID, db)
 	if err != nil {
 		return nil, err
 	}
 
-	// Sort similarities by similarity score
+	// Sort similarities by similarity score, ties by user id so the stored top matches are stable
 	sort.Slice(similarityScores, func(i, j int) bool {
-		return similarityScores[i].Score > similarityScores[j].Score // Sort in descending order
+		if similarityScores[i].Score != similarityScores[j].Score {
+			return similarityScores[i].Score > similarityScores[j].Score // Sort in descending order
+		}
+		return similarityScores[i].UserID < similarityScores[j].UserID
 	})
 
 	// create Match objects for each availability timeslot
-	matches, err := CreateUserMatches(userID, similarityScores, userAvailabilities)
+	matches, err := CreateUserMatches(userID, similarityScores, userAvailabilities, upcomingSlots)
 	if err != nil {
 		return nil, err
 	}
@@ -61,17 +103,23 @@ func ComputeMatches(userID string, db *sql.DB) ([]UserMatches, error) {
 	return matches, nil
 }
 
-// Given a base user, and a set of similarities and availabilities, create a list of Match objects between the base user and each availability in availabilities.
-func CreateUserMatches(baseUser string, sortedSimilarities []Similarity, availabilities map[string][]Availability) ([]UserMatches, error) {
+// Given a base user, and a set of similarities, weekly availabilities and upcoming slots, create a list of Match objects between the base user and each user with upcoming slots.
+func CreateUserMatches(baseUser string, sortedSimilarities []Similarity, availabilities map[string][]Availability, upcomingSlots map[string][]Slot) ([]UserMatches, error) {
 	var matches []UserMatches
 
 	// Iterate over the sorted similarities
 	for _, Similarity := range sortedSimilarities {
 		userID := Similarity.UserID
-		// Get the list of availabilities for each user
+		// Get the list of upcoming slots for each user
+		usersSlots, exists := upcomingSlots[userID]
+		if !exists {
+			continue // skip user if no upcoming slots are found
+		}
+
+		// users who only overlap through an exception have no weekly overlap
 		usersAvailabilities, exists := availabilities[userID]
 		if !exists {
-			continue // skip user if no availabilities are found
+			usersAvailabilities = weeklyFromSlots(userID, usersSlots)
 		}
 
 		match := UserMatches{
@@ -79,6 +127,7 @@ func CreateUserMatches(baseUser string, sortedSimilarities []Similarity, availab
 			User2ID:        userID,
 			Similarity:     Similarity.Score,
 			Availabilities: usersAvailabilities,
+			UpcomingSlots:  usersSlots,
 		}
 
 		// Append to matches list
@@ -87,51 +136,336 @@ func CreateUserMatches(baseUser string, sortedSimilarities []Similarity, availab
 	return matches, nil
 }
 
-// Update matches table, which stores the top BATCH_SIZE most similar matches for any given user
+/*
+Update matches table, which stores the top BATCH_SIZE most similar matches for any given user.
+Call it after userID changed anything matches depend on: their own stored matches are rebuilt,
+and the pairs with userID are re-scored in the stored matches of every other user, see updateCounterparties.
+*/
 func UpdateMatches(userID string, db *sql.DB) error {
+	computedUserMatches, err := ComputeMatches(userID, db)
+	if err != nil {
+		return err
+	}
 
-	// Clear old matches (if any)
-	ClearMatches(userID, db)
+	if err := storeMatches(userID, computedUserMatches, db); err != nil {
+		return err
+	}
+	return updateCounterparties(userID, computedUserMatches, db)
+}
 
-	// Call ComputeMatches
+// Rebuild the stored matches of userID only, for when their top BATCH_SIZE can no longer be fixed pair by pair
+func RefreshMatches(userID string, db *sql.DB) error {
 	computedUserMatches, err := ComputeMatches(userID, db)
 	if err != nil {
 		return err
 	}
-	matches := matchFromUserMatches(computedUserMatches)
+	return storeMatches(userID, computedUserMatches, db)
+}
+
+/*
+HELPER: replace the stored matches of userID with the top BATCH_SIZE users of computedUserMatches (sorted by similarity).
+The matches are written as a new generation in a single transaction, so readers see either the previous generation or the new one, never a partial one.
+*/
+func storeMatches(userID string, computedUserMatches []UserMatches, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// claim the next generation with a write, so the transaction holds the write lock from the start
+	var generation int
+	err = tx.QueryRow(`
+		INSERT INTO match_generations (user_id, generation, total)
+		VALUES (?, 1, ?)
+		ON CONFLICT(user_id) DO UPDATE SET generation = generation + 1, total = excluded.total, computed_at = CURRENT_TIMESTAMP
+		RETURNING generation
+	`, userID, len(computedUserMatches)).Scan(&generation)
+	if err != nil {
+		return fmt.Errorf("failed to start match generation: %w", err)
+	}
+
+	// Take the top users, with every overlap they have with userID
+	batch := min(len(computedUserMatches), BATCH_SIZE)
+	if err := insertMatches(matchFromUserMatches(computedUserMatches[:batch]), generation, tx); err != nil {
+		return err
+	}
+
+	// earlier generations are never read again
+	_, err = tx.Exec("DELETE FROM matches WHERE user1_id = ? AND generation < ?", userID, generation)
+	if err != nil {
+		return fmt.Errorf("failed to delete old matches: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit matches: %w", err)
+	}
+	return nil
+}
 
+// HELPER: insert match rows into the matches table, as part of generation
+func insertMatches(matches []Match, generation int, tx *sql.Tx) error {
 	// Prepare query
-	query := "INSERT INTO matches (user1_id, user2_id, day_of_week, start_time, end_time, similarity_score) VALUES (?, ?, ?, ?, ?, ?)"
-	stmt, err := db.Prepare(query)
+	query := "INSERT INTO matches (user1_id, user2_id, day_of_week, start_time, end_time, similarity_score, generation) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	stmt, err := tx.Prepare(query)
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
 	defer stmt.Close()
 
-	// Take the top 50 matches and insert into matches table
-	batch := min(len(matches), BATCH_SIZE)
-	for i := 0; i < batch; i++ {
+	for _, currentMatch := range matches {
+		_, err = stmt.Exec(currentMatch.User1ID, currentMatch.User2ID, currentMatch.DayOfWeek, currentMatch.StartTime, currentMatch.EndTime, currentMatch.Similarity, generation)
+		if err != nil {
+			return fmt.Errorf("failed to insert match: %w", err)
+		}
+	}
+	return nil
+}
 
-		currentMatch := matches[i]
+// storedMatchStats describes the stored matches of one user, relative to a counterparty
+type storedMatchStats struct {
+	Users   int     // how many users are stored, the counterparty included
+	Total   int     // how many matches the user has, stored or not
+	Floor   float64 // lowest stored similarity score, the counterparty included. Unstored matches never score higher.
+	HasUser bool    // the counterparty is stored
+}
 
-		_, err = stmt.Exec(currentMatch.User1ID, currentMatch.User2ID, currentMatch.DayOfWeek, currentMatch.StartTime, currentMatch.EndTime, currentMatch.Similarity)
-		if err != nil {
+/*
+Re-score the pair of userID with every other user in that user's stored matches, given computedUserMatches, all of userID's current matches.
+Matching is symmetric, so the other user's match with userID has the same score and overlaps.
+
+Every user who stores userID, or could now store them, is checked:
+  - a user who stores all their matches gets the pair simply added, updated or removed
+  - a partial list (capped at BATCH_SIZE) that stores userID gets the pair updated, as long as they stay above its floor
+  - a partial list that loses userID, or where their score falls under the floor, may now miss a user it never stored, so it is rebuilt with RefreshMatches
+  - a partial list where userID now scores above the floor is rebuilt too, since userID may already be counted in its total as a match it never stored
+*/
+func updateCounterparties(userID string, computedUserMatches []UserMatches, db *sql.DB) error {
+	stats, err := getStoredMatchStats(userID, db)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]UserMatches, len(computedUserMatches))
+	for _, match := range computedUserMatches {
+		current[match.User2ID] = match
+	}
+
+	var refresh []string
+	for otherID, match := range current {
+		stat, exists := stats[otherID]
+		if !exists {
+			continue // never stored, their matches are computed when they first need them
+		}
+		complete := stat.Users >= stat.Total
+
+		switch {
+		case complete || (stat.HasUser && match.Similarity >= stat.Floor):
+			// userID belongs in the list: replace the pair
+		case stat.HasUser || match.Similarity > stat.Floor:
+			refresh = append(refresh, otherID)
+			continue
+		default:
+			continue
+		}
+
+		if err := replacePair(otherID, userID, mirrorMatch(match), db); err != nil {
 			return err
 		}
 	}
 
+	// users who store userID, who is no longer their match
+	for otherID, stat := range stats {
+		if _, exists := current[otherID]; exists || !stat.HasUser {
+			continue
+		}
+		if stat.Users < stat.Total {
+			refresh = append(refresh, otherID)
+			continue
+		}
+		if err := replacePair(otherID, userID, nil, db); err != nil {
+			return err
+		}
+	}
+
+	for _, otherID := range refresh {
+		if err := RefreshMatches(otherID, db); err != nil {
+			return fmt.Errorf("failed to refresh matches of %s: %w", otherID, err)
+		}
+	}
 	return nil
 }
 
-// Fetch all matches for userID in the matches table
+// HELPER: how full the stored matches of every other user are, relative to counterpartyID. Users whose matches were never stored are left out.
+func getStoredMatchStats(counterpartyID string, db *sql.DB) (map[string]storedMatchStats, error) {
+	rows, err := db.Query(`
+		SELECT g.user_id, COUNT(DISTINCT m.user2_id), g.total, COALESCE(MIN(m.similarity_score), 0), COALESCE(MAX(m.user2_id = ?), 0)
+		FROM match_generations g
+		LEFT JOIN matches m ON m.user1_id = g.user_id AND m.generation = g.generation
+		WHERE g.user_id != ?
+		GROUP BY g.user_id
+	`, counterpartyID, counterpartyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stored matches: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make(map[string]storedMatchStats)
+	for rows.Next() {
+		var userID string
+		var stat storedMatchStats
+		if err := rows.Scan(&userID, &stat.Users, &stat.Total, &stat.Floor, &stat.HasUser); err != nil {
+			return nil, fmt.Errorf("failed to scan stored matches: %w", err)
+		}
+		stats[userID] = stat
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stored matches: %w", err)
+	}
+	return stats, nil
+}
+
+// HELPER: replace the rows of otherID in userID's stored matches with match, or only delete them if match is nil, in a single transaction. See replacePairTx.
+func replacePair(userID string, otherID string, match *UserMatches, db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := replacePairTx(userID, otherID, match, tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit pair matches: %w", err)
+	}
+	return nil
+}
+
+/*
+HELPER: replace the rows of otherID in userID's stored matches with match, or only delete them if match is nil, as part of tx.
+The rows are changed in place in the current generation of userID, and its total goes up or down by one when otherID joins or leaves the stored matches.
+The lowest scored users are then dropped to keep the top BATCH_SIZE, and stay counted in the total.
+A match of userID that was never stored cannot be told apart from a non-match, so removing one leaves the total alone until the next RefreshMatches.
+*/
+func replacePairTx(userID string, otherID string, match *UserMatches, tx *sql.Tx) error {
+	// write before reading, so the transaction holds the write lock from the start
+	result, err := tx.Exec("DELETE FROM matches WHERE user1_id = ? AND user2_id = ?", userID, otherID)
+	if err != nil {
+		return fmt.Errorf("failed to delete pair matches: %w", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to count pair matches: %w", err)
+	}
+
+	var generation int
+	err = tx.QueryRow("SELECT generation FROM match_generations WHERE user_id = ?", userID).Scan(&generation)
+	if err == sql.ErrNoRows {
+		return nil // never stored, there is nothing to keep up to date
+	} else if err != nil {
+		return fmt.Errorf("failed to get match generation: %w", err)
+	}
+
+	var inserted []Match
+	if match != nil {
+		inserted = matchFromUserMatches([]UserMatches{*match})
+		if err := insertMatches(inserted, generation, tx); err != nil {
+			return err
+		}
+	}
+
+	change := 0
+	if len(inserted) > 0 {
+		change++
+	}
+	if removed > 0 {
+		change--
+	}
+	if change != 0 {
+		_, err = tx.Exec("UPDATE match_generations SET total = MAX(total + ?, 0) WHERE user_id = ?", change, userID)
+		if err != nil {
+			return fmt.Errorf("failed to update match total: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM matches
+		WHERE user1_id = ? AND generation = ? AND user2_id IN (
+			SELECT user2_id FROM matches
+			WHERE user1_id = ? AND generation = ?
+			GROUP BY user2_id
+			ORDER BY MAX(similarity_score) DESC, user2_id
+			LIMIT -1 OFFSET ?
+		)
+	`, userID, generation, userID, generation, BATCH_SIZE)
+	if err != nil {
+		return fmt.Errorf("failed to trim matches: %w", err)
+	}
+	return nil
+}
+
+// HELPER: the same match, seen from the other user
+func mirrorMatch(match UserMatches) *UserMatches {
+	mirrored := UserMatches{
+		User1ID:    match.User2ID,
+		User2ID:    match.User1ID,
+		Similarity: match.Similarity,
+	}
+	for _, availability := range match.Availabilities {
+		availability.UserID = match.User1ID
+		mirrored.Availabilities = append(mirrored.Availabilities, availability)
+	}
+	return &mirrored
+}
+
+// Fetch the stored matches of userID in the matches table, sorted by similarity score (ties by user id)
 func GetMatches(userID string, db *sql.DB) ([]UserMatches, error) {
+	matches, _, _, err := GetStoredMatches(userID, db)
+	return matches, err
+}
 
-	query := "SELECT id, user1_id, user2_id, day_of_week, start_time, end_time, similarity_score FROM matches WHERE user1_id = ? OR user2_id = ?"
+/*
+Fetch the stored matches of userID in the matches table, from the last complete generation.
+
+Returns:
+
+	[]UserMatches
+		the stored matches, sorted by similarity score (ties by user id)
+	total int
+		how many matches userID had when the generation was computed, stored or not
+	stored bool
+		false if the matches of userID were never stored
+*/
+func GetStoredMatches(userID string, db *sql.DB) ([]UserMatches, int, bool, error) {
+	// read the generation and its rows from the same snapshot
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var generation, total int
+	err = tx.QueryRow("SELECT generation, total FROM match_generations WHERE user_id = ?", userID).Scan(&generation, &total)
+	if err == sql.ErrNoRows {
+		return nil, 0, false, nil
+	} else if err != nil {
+		return nil, 0, false, fmt.Errorf("error getting match generation: %w", err)
+	}
+
+	// rows are stored from user1's point of view, so only user1's rows are their matches
+	query := `
+		SELECT id, user1_id, user2_id, day_of_week, start_time, end_time, similarity_score
+		FROM matches
+		WHERE user1_id = ? AND generation = ?
+		ORDER BY similarity_score DESC, user2_id, id
+	`
 
-	rows, err := db.Query(query, userID, userID)
+	rows, err := tx.Query(query, userID, generation)
 	if err != nil {
 
-		return nil, fmt.Errorf("error getting matches: %w", err)
+		return nil, 0, false, fmt.Errorf("error getting matches: %w", err)
 	}
 	defer rows.Close()
 
@@ -143,7 +477,7 @@ func GetMatches(userID string, db *sql.DB) ([]UserMatches, error) {
 		// Scan each row into a Match struct
 		err := rows.Scan(&match.ID, &match.User1ID, &match.User2ID, &match.DayOfWeek, &match.StartTime, &match.EndTime, &match.Similarity)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning row: %w", err)
+			return nil, 0, false, fmt.Errorf("error scanning row: %w", err)
 		}
 
 		// Add the match to the slice
@@ -152,22 +486,46 @@ func GetMatches(userID string, db *sql.DB) ([]UserMatches, error) {
 
 	// Check for errors encountered during iteration
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+		return nil, 0, false, fmt.Errorf("error iterating rows: %w", err)
 	}
 
-	return userMatchesFromMatch(matches), nil
+	return userMatchesFromMatch(matches), total, true, nil
 }
 
-// Clear all the matches for userID in the matches table
-func ClearMatches(userID string, db *sql.DB) error {
-	query := "DELETE FROM matches WHERE user1_id = ? OR user2_id = ?"
+// StoredMatchesStale reports whether the stored matches of userID were never computed, or were last rebuilt more than MATCHES_MAX_AGE ago
+func StoredMatchesStale(userID string, db *sql.DB) (bool, error) {
+	var stale bool
+	err := db.QueryRow(
+		"SELECT computed_at IS NULL OR computed_at < datetime('now', ?) FROM match_generations WHERE user_id = ?",
+		fmt.Sprintf("-%d seconds", int(MATCHES_MAX_AGE.Seconds())), userID,
+	).Scan(&stale)
+	if err == sql.ErrNoRows {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error getting match generation: %w", err)
+	}
+	return stale, nil
+}
 
-	_, err := db.Exec(query, userID, userID)
+// Return the match of userID with otherID, from the stored matches if they include it and computed otherwise. Returns ErrMatchNotFound if the pair is not a match.
+func GetMatch(userID string, otherID string, db *sql.DB) (UserMatches, error) {
+	matches, total, stored, err := GetStoredMatches(userID, db)
 	if err != nil {
-		return fmt.Errorf("failed to delete matches: %w", err)
+		return UserMatches{}, err
+	}
+	if !stored || len(matches) < total {
+		// otherID may be past the stored top matches
+		if matches, err = ComputeMatches(userID, db); err != nil {
+			return UserMatches{}, err
+		}
 	}
 
-	return nil
+	for _, match := range matches {
+		if match.User2ID == otherID {
+			return match, nil
+		}
+	}
+	return UserMatches{}, ErrMatchNotFound
 }
 
 // HELPER: Convert a list of userMatches into Match objects
@@ -194,24 +552,28 @@ func matchFromUserMatches(userMatches []UserMatches) []Match {
 	return matches
 }
 
-// HELPER: Convert a list of matches into UserMatches objects
+// HELPER: Convert a list of matches into UserMatches objects, in the order each user first appears
 func userMatchesFromMatch(matches []Match) []UserMatches {
-	userMatchesMap := make(map[string]*UserMatches)
+	var userMatchesList []UserMatches
+	positions := make(map[string]int) // index of every User2ID in userMatchesList
 
 	// Iterate through the matches and group them by User2ID
 	for _, match := range matches {
-		// If the User2ID is not already in the map, initialize it
-		if _, exists := userMatchesMap[match.User2ID]; !exists {
-			userMatchesMap[match.User2ID] = &UserMatches{
+		// If the User2ID is not already in the list, initialize it
+		position, exists := positions[match.User2ID]
+		if !exists {
+			position = len(userMatchesList)
+			positions[match.User2ID] = position
+			userMatchesList = append(userMatchesList, UserMatches{
 				User1ID:    match.User1ID,
 				User2ID:    match.User2ID,
 				Similarity: match.Similarity,
-			}
+			})
 		}
 
 		// Add the availability to the corresponding UserMatches entry
-		userMatchesMap[match.User2ID].Availabilities = append(
-			userMatchesMap[match.User2ID].Availabilities,
+		userMatchesList[position].Availabilities = append(
+			userMatchesList[position].Availabilities,
 			Availability{
 				UserID:    match.User2ID,
 				StartTime: match.StartTime,
@@ -221,11 +583,51 @@ func userMatchesFromMatch(matches []Match) []UserMatches {
 		)
 	}
 
-	// Convert the map to a slice
-	var userMatchesList []UserMatches
-	for _, um := range userMatchesMap {
-		userMatchesList = append(userMatchesList, *um)
+	return userMatchesList
+}
+
+// MatchCursor is the position of a match in the ordering of matches: similarity score descending, ties by user id
+type MatchCursor struct {
+	Similarity float64
+	UserID     string
+}
+
+// Encode the cursor as an opaque string for the next_cursor of GET /matches
+func (c MatchCursor) Encode() string {
+	raw := strconv.FormatFloat(c.Similarity, 'g', -1, 64) + "|" + c.UserID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Parse a cursor made by MatchCursor.Encode. Returns ErrInvalidCursor if it is malformed.
+func ParseMatchCursor(encoded string) (MatchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return MatchCursor{}, ErrInvalidCursor
 	}
+	score, userID, found := strings.Cut(string(raw), "|")
+	if !found || userID == "" {
+		return MatchCursor{}, ErrInvalidCursor
+	}
+	similarity, err := strconv.ParseFloat(score, 64)
+	if err != nil {
+		return MatchCursor{}, ErrInvalidCursor
+	}
+	return MatchCursor{Similarity: similarity, UserID: userID}, nil
+}
 
-	return userMatchesList
+// CursorOf returns the cursor pointing at match
+func CursorOf(match UserMatches) MatchCursor {
+	return MatchCursor{Similarity: match.Similarity, UserID: match.User2ID}
+}
+
+// MatchesAfter returns the matches that come after cursor, given matches in the ordering of MatchCursor. A nil cursor returns every match.
+func MatchesAfter(matches []UserMatches, cursor *MatchCursor) []UserMatches {
+	if cursor == nil {
+		return matches
+	}
+	start := sort.Search(len(matches), func(i int) bool {
+		return matches[i].Similarity < cursor.Similarity ||
+			(matches[i].Similarity == cursor.Similarity && matches[i].User2ID > cursor.UserID)
+	})
+	return matches[start:]
 }
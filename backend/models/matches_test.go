@@ -0,0 +1,111 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestMatchCursorRoundTrip(t *testing.T) {
+	cursors := []MatchCursor{
+		{Similarity: 0.87, UserID: "9e2d0dec-fec2-4cab-b742-bad2ea343490"},
+		{Similarity: 0, UserID: "a"},
+		{Similarity: -1.5, UserID: "b"},
+		{Similarity: 2.0 / 3, UserID: "c"},       // needs every digit, so the score has to survive without rounding
+		{Similarity: 1e-12, UserID: "with|pipe"}, // only the first "|" separates the score
+	}
+
+	for _, cursor := range cursors {
+		parsed, err := ParseMatchCursor(cursor.Encode())
+		if err != nil {
+			t.Errorf("ParseMatchCursor(%v.Encode()): unexpected error %v", cursor, err)
+			continue
+		}
+		if parsed != cursor {
+			t.Errorf("ParseMatchCursor(%v.Encode()) = %v", cursor, parsed)
+		}
+	}
+}
+
+func TestParseMatchCursorInvalid(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	invalid := map[string]string{
+		"not base64":       "not base64!",
+		"empty":            "",
+		"no separator":     encode("0.5"),
+		"no user id":       encode("0.5|"),
+		"score not number": encode("high|user"),
+		"padded base64":    base64.URLEncoding.EncodeToString([]byte("0.5|u")),
+	}
+
+	for name, encoded := range invalid {
+		if _, err := ParseMatchCursor(encoded); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: ParseMatchCursor(%q) error = %v, want %v", name, encoded, err, ErrInvalidCursor)
+		}
+	}
+}
+
+func TestMatchesAfter(t *testing.T) {
+	// in cursor order: similarity descending, ties by user id
+	matches := []UserMatches{
+		{User2ID: "a", Similarity: 0.9},
+		{User2ID: "b", Similarity: 0.7},
+		{User2ID: "c", Similarity: 0.7},
+		{User2ID: "d", Similarity: 0.7},
+		{User2ID: "e", Similarity: 0.4},
+		{User2ID: "f", Similarity: 0.1},
+	}
+	ids := func(matches []UserMatches) []string {
+		var ids []string
+		for _, match := range matches {
+			ids = append(ids, match.User2ID)
+		}
+		return ids
+	}
+
+	if got := MatchesAfter(matches, nil); len(got) != len(matches) {
+		t.Errorf("MatchesAfter(nil) = %v, want every match", ids(got))
+	}
+
+	// walking pages through encoded cursors visits every match once, also across ties
+	for pageSize := 1; pageSize <= len(matches); pageSize++ {
+		var seen []string
+		var cursor *MatchCursor
+		for {
+			page := MatchesAfter(matches, cursor)
+			if len(page) == 0 {
+				break
+			}
+			page = page[:min(pageSize, len(page))]
+			seen = append(seen, ids(page)...)
+
+			next, err := ParseMatchCursor(CursorOf(page[len(page)-1]).Encode())
+			if err != nil {
+				t.Fatalf("page size %d: unexpected error %v", pageSize, err)
+			}
+			cursor = &next
+		}
+		if !slices.Equal(seen, ids(matches)) {
+			t.Errorf("page size %d: visited %v, want %v", pageSize, seen, ids(matches))
+		}
+	}
+
+	// a cursor whose match is gone still resumes at the right place
+	tests := []struct {
+		cursor MatchCursor
+		want   []string
+	}{
+		{MatchCursor{Similarity: 0.7, UserID: "bb"}, []string{"c", "d", "e", "f"}},
+		{MatchCursor{Similarity: 0.8, UserID: "z"}, []string{"b", "c", "d", "e", "f"}},
+		{MatchCursor{Similarity: 0.05, UserID: "a"}, nil},
+		{MatchCursor{Similarity: 1, UserID: "a"}, []string{"a", "b", "c", "d", "e", "f"}},
+	}
+	for _, test := range tests {
+		if got := ids(MatchesAfter(matches, &test.cursor)); !slices.Equal(got, test.want) {
+			t.Errorf("MatchesAfter(%v) = %v, want %v", test.cursor, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Per-user preferences for the overlaps matching offers: how long a date has to be at least, and the granularity slots are cut to
+*/
+
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// preferences of users who never set any
+const (
+	DEFAULT_MIN_DATE_MINUTES         = 30
+	DEFAULT_SLOT_GRANULARITY_MINUTES = 30
+)
+
+// granularities a user can pick, in minutes
+var SLOT_GRANULARITIES = []int{15, 30, 60, 90, 120}
+
+// SlotPreferences controls which overlaps are long enough to offer as a date
+type SlotPreferences struct {
+	MinDateMinutes         int // overlaps shorter than this are dropped
+	SlotGranularityMinutes int // overlaps start on this grid (at most hourly) and last a multiple of it
+}
+
+// HELPER: the preferences that satisfy both users, i.e. the stricter of each
+func combinePreferences(a, b SlotPreferences) SlotPreferences {
+	return SlotPreferences{
+		MinDateMinutes:         max(a.MinDateMinutes, b.MinDateMinutes),
+		SlotGranularityMinutes: max(a.SlotGranularityMinutes, b.SlotGranularityMinutes),
+	}
+}
+
+// HELPER: fill in defaults for preferences that are not set
+func normalizePreferences(p SlotPreferences) SlotPreferences {
+	if p.MinDateMinutes <= 0 {
+		p.MinDateMinutes = DEFAULT_MIN_DATE_MINUTES
+	}
+	if p.SlotGranularityMinutes <= 0 {
+		p.SlotGranularityMinutes = DEFAULT_SLOT_GRANULARITY_MINUTES
+	}
+	return p
+}
+
+// HELPER: minutes the start of an overlap is aligned to, never coarser than an hour so slots still start on the hour
+func (p SlotPreferences) alignment() int {
+	return min(p.SlotGranularityMinutes, 60)
+}
+
+// HELPER: cut week ranges to the preferences, dropping the ones that end up too short
+func fitRanges(ranges []minuteRange, p SlotPreferences) []minuteRange {
+	var fitted []minuteRange
+	align := p.alignment()
+	for _, r := range mergeRanges(ranges) {
+		start := (r.start + align - 1) / align * align
+		length := (r.end - start) / p.SlotGranularityMinutes * p.SlotGranularityMinutes
+		if length > 0 && length >= p.MinDateMinutes {
+			fitted = append(fitted, minuteRange{start, start + length})
+		}
+	}
+	return fitted
+}
+
+// HELPER: cut concrete slots to the preferences, aligning their starts on the clock in loc and dropping the ones that end up too short
+func fitSlots(slots []Slot, p SlotPreferences, loc *time.Location) []Slot {
+	var fitted []Slot
+	granularity := time.Duration(p.SlotGranularityMinutes) * time.Minute
+	for _, slot := range mergeSlots(slots) {
+		start := alignStart(slot.Start, p.alignment(), loc)
+		length := slot.End.Sub(start) / granularity * granularity
+		if length > 0 && length >= time.Duration(p.MinDateMinutes)*time.Minute {
+			fitted = append(fitted, Slot{Start: start.In(slot.Start.Location()), End: start.Add(length).In(slot.Start.Location())})
+		}
+	}
+	return fitted
+}
+
+// HELPER: the first time at or after t whose minute of the day in loc is a multiple of align
+func alignStart(t time.Time, align int, loc *time.Location) time.Time {
+	local := t.In(loc)
+	minutes := local.Hour()*60 + local.Minute()
+	if local.Second() > 0 || local.Nanosecond() > 0 {
+		minutes++
+	}
+	minutes = (minutes + align - 1) / align * align
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, minutes, 0, 0, loc)
+	for start.Before(t) { // the wall clock skipped ahead, e.g. at a daylight saving time change
+		start = start.Add(time.Duration(align) * time.Minute)
+	}
+	return start
+}
+
+// HELPER: the slot preferences of every user in userIDs, or of every user if userIDs is nil
+func getSlotPreferences(userIDs []string, db *sql.DB) (map[string]SlotPreferences, error) {
+	query := "SELECT id, COALESCE(min_date_minutes, 0), COALESCE(slot_granularity_minutes, 0) FROM users"
+	var args []interface{}
+	if userIDs != nil {
+		if len(userIDs) == 0 {
+			return map[string]SlotPreferences{}, nil
+		}
+		query += " WHERE id IN (" + strings.TrimSuffix(strings.Repeat("?,", len(userIDs)), ",") + ")"
+		for _, id := range userIDs {
+			args = append(args, id)
+		}
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get slot preferences: %w", err)
+	}
+	defer rows.Close()
+
+	preferences := make(map[string]SlotPreferences)
+	for rows.Next() {
+		var userID string
+		var p SlotPreferences
+		if err := rows.Scan(&userID, &p.MinDateMinutes, &p.SlotGranularityMinutes); err != nil {
+			return nil, fmt.Errorf("failed to scan slot preferences: %w", err)
+		}
+		preferences[userID] = normalizePreferences(p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over slot preferences: %w", err)
+	}
+	return preferences, nil
+}
+
+// HELPER: preferences of userID, with defaults for unknown users
+func preferencesOf(preferences map[string]SlotPreferences, userID string) SlotPreferences {
+	return normalizePreferences(preferences[userID])
+}
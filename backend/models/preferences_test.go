@@ -0,0 +1,67 @@
+package models
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFitRanges(t *testing.T) {
+	defaults := normalizePreferences(SlotPreferences{})
+
+	tests := []struct {
+		name   string
+		ranges []minuteRange
+		prefs  SlotPreferences
+		want   []minuteRange
+	}{
+		{"defaults drop short overlaps", []minuteRange{{600, 620}}, defaults, nil},
+		{"defaults keep half an hour", []minuteRange{{600, 630}}, defaults, []minuteRange{{600, 630}}},
+		{"start is aligned to the granularity", []minuteRange{{605, 700}}, defaults, []minuteRange{{630, 690}}},
+		{"touching ranges are merged first", []minuteRange{{600, 615}, {615, 630}}, defaults, []minuteRange{{600, 630}}},
+		{"longer minimum", []minuteRange{{600, 660}, {720, 840}}, SlotPreferences{90, 30}, []minuteRange{{720, 840}}},
+		{"granularity above an hour aligns to the hour", []minuteRange{{610, 800}}, SlotPreferences{30, 90}, []minuteRange{{660, 750}}},
+		{"15 minute slots", []minuteRange{{607, 650}}, SlotPreferences{15, 15}, []minuteRange{{615, 645}}},
+	}
+
+	for _, test := range tests {
+		if got := fitRanges(test.ranges, test.prefs); !slices.Equal(got, test.want) {
+			t.Errorf("%s: fitRanges = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFitSlots(t *testing.T) {
+	kolkata := time.FixedZone("IST", 5*60*60+30*60)
+	at := func(hour, minute int) time.Time {
+		return time.Date(2025, 3, 3, hour, minute, 0, 0, kolkata)
+	}
+	slots := []Slot{{Start: at(10, 5), End: at(12, 0)}}
+
+	// half hours start on the user's clock, not on UTC boundaries which are 30 minutes off in India
+	got := fitSlots(slots, SlotPreferences{30, 60}, kolkata)
+	if want := []Slot{{Start: at(11, 0), End: at(12, 0)}}; !slices.Equal(got, want) {
+		t.Errorf("fitSlots in %s = %v, want %v", kolkata, got, want)
+	}
+	got = fitSlots(slots, SlotPreferences{30, 30}, kolkata)
+	if want := []Slot{{Start: at(10, 30), End: at(12, 0)}}; !slices.Equal(got, want) {
+		t.Errorf("fitSlots in %s = %v, want %v", kolkata, got, want)
+	}
+
+	// on a UTC clock the hour starts at 10:30 in India
+	got = fitSlots(slots, SlotPreferences{30, 60}, time.UTC)
+	if want := []Slot{{Start: at(10, 30), End: at(11, 30)}}; !slices.Equal(got, want) {
+		t.Errorf("fitSlots in UTC = %v, want %v", got, want)
+	}
+}
+
+func TestCombinePreferences(t *testing.T) {
+	got := combinePreferences(SlotPreferences{60, 15}, SlotPreferences{30, 90})
+	if want := (SlotPreferences{60, 90}); got != want {
+		t.Errorf("combinePreferences = %v, want %v", got, want)
+	}
+
+	if got := normalizePreferences(SlotPreferences{}); got.MinDateMinutes != DEFAULT_MIN_DATE_MINUTES || got.SlotGranularityMinutes != DEFAULT_SLOT_GRANULARITY_MINUTES {
+		t.Errorf("normalizePreferences of unset preferences = %v, want the defaults", got)
+	}
+}
@@ -0,0 +1,371 @@
+/*
+Multi-slot date proposals: a date can be proposed with several candidate timeslots, and the other user can accept one of them or counter-propose a new set
+*/
+
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// statuses of a single negotiation round
+const (
+	ProposalOpen      = "open"
+	ProposalCountered = "countered"
+	ProposalAccepted  = "accepted"
+	ProposalClosed    = "closed" // the date was rejected, withdrawn or expired before a slot was accepted
+)
+
+var (
+	ErrNoOpenProposal = errors.New("date has no open proposal")
+	ErrSlotNotFound   = errors.New("slot is not part of the open proposal")
+)
+
+// represent the date_proposal_slots table
+type ProposalSlot struct {
+	ID         int    `json:"id"`
+	ProposalID int    `json:"proposal_id"`
+	DateStart  string `json:"date_start"`
+	DateEnd    string `json:"date_end"`
+}
+
+// represent the date_proposals table, one row per negotiation round
+type Proposal struct {
+	ID             int            `json:"id"`
+	DateID         int            `json:"date_id"`
+	Round          int            `json:"round"`
+	ProposerID     string         `json:"proposer_id"`
+	Status         string         `json:"status"`
+	AcceptedSlotID *int           `json:"accepted_slot_id"`
+	CreatedAt      string         `json:"created_at"`
+	Slots          []ProposalSlot `json:"slots"`
+}
+
+/*
+ProposeDate creates a new pending date between date.User1ID and date.User2ID, together with the first negotiation round holding the candidate slots.
+The date's date_start and date_end are set to the earliest slot until one is accepted.
+
+Returns:
+
+	id of the new date, and the first round
+*/
+func ProposeDate(date Date, slots []ProposalSlot, db *sql.DB) (int, *Proposal, error) {
+	if len(slots) == 0 {
+		return -1, nil, errors.New("a proposal needs at least one slot")
+	}
+	sortSlots(slots)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return -1, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO scheduled_dates (user1_id, user2_id, date_start, date_end, status)
+		VALUES (?, ?, ?, ?, ?)
+	`, date.User1ID, date.User2ID, slots[0].DateStart, slots[0].DateEnd, StatusPending)
+	if err != nil {
+		return -1, nil, fmt.Errorf("failed to insert scheduled date: %w", err)
+	}
+	dateID, err := result.LastInsertId()
+	if err != nil {
+		return -1, nil, fmt.Errorf("failed to fetch last insert id: %w", err)
+	}
+
+	proposal, err := insertProposal(int(dateID), 1, date.User1ID, slots, tx)
+	if err != nil {
+		return -1, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, nil, fmt.Errorf("failed to commit proposal: %w", err)
+	}
+	return int(dateID), proposal, nil
+}
+
+/*
+CounterProposal replaces the open round of a pending date with a new set of slots proposed by userID.
+Only the user who received the open round can counter it.
+
+Returns:
+
+	the new round
+*/
+func CounterProposal(date *Date, userID string, slots []ProposalSlot, db *sql.DB) (*Proposal, error) {
+	if len(slots) == 0 {
+		return nil, errors.New("a proposal needs at least one slot")
+	}
+	sortSlots(slots)
+
+	open, err := GetOpenProposal(date.ID, db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkProposalRecipient(date, open, userID, StatusPending); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// close the open round, making sure nobody else answered it first
+	result, err := tx.Exec("UPDATE date_proposals SET status = ? WHERE id = ? AND status = ?", ProposalCountered, open.ID, ProposalOpen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to close proposal: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return nil, ErrNoOpenProposal
+	}
+
+	proposal, err := insertProposal(date.ID, open.Round+1, userID, slots, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the date shows the earliest candidate slot until one is accepted
+	_, err = tx.Exec("UPDATE scheduled_dates SET date_start = ?, date_end = ? WHERE id = ?", slots[0].DateStart, slots[0].DateEnd, date.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update scheduled date: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit counter-proposal: %w", err)
+	}
+	return proposal, nil
+}
+
+/*
+AcceptProposalSlot confirms a pending date at one of the slots of its open round.
+Only the user who received the open round can accept it.
+*/
+func AcceptProposalSlot(date *Date, slotID int, userID string, db *sql.DB) error {
+	open, err := GetOpenProposal(date.ID, db)
+	if err != nil {
+		return err
+	}
+	if err := checkProposalRecipient(date, open, userID, StatusConfirmed); err != nil {
+		return err
+	}
+	slot := open.FindSlot(slotID)
+	if slot == nil {
+		return ErrSlotNotFound
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE date_proposals SET status = ?, accepted_slot_id = ? WHERE id = ? AND status = ?", ProposalAccepted, slot.ID, open.ID, ProposalOpen)
+	if err != nil {
+		return fmt.Errorf("failed to accept proposal: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return ErrNoOpenProposal
+	}
+
+	result, err = tx.Exec(`
+		UPDATE scheduled_dates
+		SET date_start = ?, date_end = ?, status = ?
+		WHERE id = ? AND status = ?
+	`, slot.DateStart, slot.DateEnd, StatusConfirmed, date.ID, StatusPending)
+	if err != nil {
+		return fmt.Errorf("failed to confirm scheduled date: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return &TransitionError{From: date.Status, To: StatusConfirmed, Err: ErrIllegalTransition}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit acceptance: %w", err)
+	}
+
+	date.DateStart = slot.DateStart
+	date.DateEnd = slot.DateEnd
+	date.Status = StatusConfirmed
+	return nil
+}
+
+// GetProposals returns every negotiation round of a date, oldest first
+func GetProposals(dateID int, db *sql.DB) ([]Proposal, error) {
+	rows, err := db.Query(`
+		SELECT id, date_id, round, proposer_id, status, accepted_slot_id, created_at
+		FROM date_proposals
+		WHERE date_id = ?
+		ORDER BY round
+	`, dateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query proposals: %w", err)
+	}
+	defer rows.Close()
+
+	var proposals []Proposal
+	for rows.Next() {
+		var p Proposal
+		if err := rows.Scan(&p.ID, &p.DateID, &p.Round, &p.ProposerID, &p.Status, &p.AcceptedSlotID, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		proposals = append(proposals, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	// attach the slots of each round
+	for i := range proposals {
+		slots, err := getProposalSlots(proposals[i].ID, db)
+		if err != nil {
+			return nil, err
+		}
+		proposals[i].Slots = slots
+	}
+
+	return proposals, nil
+}
+
+// GetOpenProposal returns the round of a date that is still waiting for an answer, or ErrNoOpenProposal
+func GetOpenProposal(dateID int, db *sql.DB) (*Proposal, error) {
+	var p Proposal
+	err := db.QueryRow(`
+		SELECT id, date_id, round, proposer_id, status, accepted_slot_id, created_at
+		FROM date_proposals
+		WHERE date_id = ? AND status = ?
+	`, dateID, ProposalOpen).Scan(&p.ID, &p.DateID, &p.Round, &p.ProposerID, &p.Status, &p.AcceptedSlotID, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoOpenProposal
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to query open proposal: %w", err)
+	}
+
+	p.Slots, err = getProposalSlots(p.ID, db)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// HELPER: make sure userID is the participant who received the open round, and that the date can move to status `to`
+func checkProposalRecipient(date *Date, open *Proposal, userID string, to string) error {
+	role, err := NegotiatingRoleOf(date, open, userID)
+	if err != nil {
+		return &TransitionError{From: date.Status, To: to, Err: err}
+	}
+	if to == StatusPending {
+		// countering keeps the date pending, but is only allowed for a pending date and for whoever could confirm it
+		err := CheckDateTransition(date.Status, StatusConfirmed, role)
+		var transitionErr *TransitionError
+		if errors.As(err, &transitionErr) {
+			transitionErr.To = ProposalCountered
+		}
+		return err
+	}
+	return CheckDateTransition(date.Status, to, role)
+}
+
+// HELPER: close the open round of a date that stopped being pending, so it no longer waits for an answer
+func closeOpenProposal(dateID int, tx *sql.Tx) error {
+	_, err := tx.Exec("UPDATE date_proposals SET status = ? WHERE date_id = ? AND status = ?", ProposalClosed, dateID, ProposalOpen)
+	if err != nil {
+		return fmt.Errorf("failed to close proposal: %w", err)
+	}
+	return nil
+}
+
+// HELPER: insert a round and its slots
+func insertProposal(dateID int, round int, proposerID string, slots []ProposalSlot, tx *sql.Tx) (*Proposal, error) {
+	result, err := tx.Exec(`
+		INSERT INTO date_proposals (date_id, round, proposer_id, status)
+		VALUES (?, ?, ?, ?)
+	`, dateID, round, proposerID, ProposalOpen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert proposal: %w", err)
+	}
+	proposalID, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch last insert id: %w", err)
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO date_proposal_slots (proposal_id, slot_start, slot_end) VALUES (?, ?, ?)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	proposal := &Proposal{
+		ID:         int(proposalID),
+		DateID:     dateID,
+		Round:      round,
+		ProposerID: proposerID,
+		Status:     ProposalOpen,
+	}
+	for _, slot := range slots {
+		result, err := stmt.Exec(proposalID, slot.DateStart, slot.DateEnd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert proposal slot: %w", err)
+		}
+		slotID, err := result.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch last insert id: %w", err)
+		}
+		slot.ID = int(slotID)
+		slot.ProposalID = int(proposalID)
+		proposal.Slots = append(proposal.Slots, slot)
+	}
+
+	return proposal, nil
+}
+
+// HELPER: get the slots of a single round, earliest first
+func getProposalSlots(proposalID int, db *sql.DB) ([]ProposalSlot, error) {
+	rows, err := db.Query(`
+		SELECT id, proposal_id, slot_start, slot_end
+		FROM date_proposal_slots
+		WHERE proposal_id = ?
+		ORDER BY JULIANDAY(slot_start)
+	`, proposalID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query proposal slots: %w", err)
+	}
+	defer rows.Close()
+
+	var slots []ProposalSlot
+	for rows.Next() {
+		var slot ProposalSlot
+		if err := rows.Scan(&slot.ID, &slot.ProposalID, &slot.DateStart, &slot.DateEnd); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		slots = append(slots, slot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return slots, nil
+}
+
+// FindSlot returns the slot of the round with the given id, or nil
+func (p *Proposal) FindSlot(slotID int) *ProposalSlot {
+	for i := range p.Slots {
+		if p.Slots[i].ID == slotID {
+			return &p.Slots[i]
+		}
+	}
+	return nil
+}
+
+// HELPER: sort slots by their start (slots are already validated ISO 8601 timestamps)
+func sortSlots(slots []ProposalSlot) {
+	sort.SliceStable(slots, func(i, j int) bool {
+		start1, _ := time.Parse(time.RFC3339, slots[i].DateStart)
+		start2, _ := time.Parse(time.RFC3339, slots[j].DateStart)
+		return start1.Before(start2)
+	})
+}
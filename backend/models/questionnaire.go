@@ -0,0 +1,157 @@
+/*
+Versioned quiz questionnaire: which question each element of users.vector answers, and which answers are allowed
+*/
+
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// the questionnaire that used to be hard-coded in the quiz page, which users without a recorded version answered
+const ORIGINAL_QUESTIONNAIRE_VERSION = 1
+
+var (
+	ErrNoActiveQuestionnaire = errors.New("no active questionnaire")
+	ErrQuestionnaireNotFound = errors.New("questionnaire version not found")
+	ErrInvalidVector         = errors.New("invalid similarity vector")
+)
+
+type Question struct {
+	ID        int    `json:"id"`
+	VersionID int    `json:"version_id"`
+	Position  int    `json:"position"` // index of the answer in the similarity vector
+	Prompt    string `json:"prompt"`
+	MinLabel  string `json:"min_label"`
+	MaxLabel  string `json:"max_label"`
+	MinValue  int    `json:"min_value"`
+	MaxValue  int    `json:"max_value"`
+}
+
+type Questionnaire struct {
+	Version   int        `json:"version"`
+	Questions []Question `json:"questions"` // ordered by position
+}
+
+// Return the questionnaire version served by the quiz
+func GetActiveQuestionnaire(db *sql.DB) (*Questionnaire, error) {
+	var versionID int
+	err := db.QueryRow("SELECT id FROM questionnaire_versions WHERE is_active").Scan(&versionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNoActiveQuestionnaire
+		}
+		return nil, fmt.Errorf("error querying active questionnaire: %w", err)
+	}
+	return GetQuestionnaire(versionID, db)
+}
+
+// Return the questions of a questionnaire version
+func GetQuestionnaire(versionID int, db *sql.DB) (*Questionnaire, error) {
+	rows, err := db.Query(`
+		SELECT id, version_id, position, prompt, COALESCE(min_label, ''), COALESCE(max_label, ''), min_value, max_value
+		FROM questions
+		WHERE version_id = ?
+		ORDER BY position
+	`, versionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query questions: %w", err)
+	}
+	defer rows.Close()
+
+	questionnaire := Questionnaire{Version: versionID, Questions: []Question{}}
+	for rows.Next() {
+		var question Question
+		err := rows.Scan(&question.ID, &question.VersionID, &question.Position, &question.Prompt,
+			&question.MinLabel, &question.MaxLabel, &question.MinValue, &question.MaxValue)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan question: %w", err)
+		}
+		questionnaire.Questions = append(questionnaire.Questions, question)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating questions: %w", err)
+	}
+
+	if len(questionnaire.Questions) == 0 {
+		return nil, fmt.Errorf("%w: %d", ErrQuestionnaireNotFound, versionID)
+	}
+	return &questionnaire, nil
+}
+
+// Scales returns the answer scale of each question, in vector order
+func (q *Questionnaire) Scales() []AnswerScale {
+	scales := make([]AnswerScale, len(q.Questions))
+	for i, question := range q.Questions {
+		scales[i] = AnswerScale{Min: question.MinValue, Max: question.MaxValue}
+	}
+	return scales
+}
+
+// ValidateVector checks that vector has exactly one answer within range for every question
+func (q *Questionnaire) ValidateVector(vector []int) error {
+	if len(vector) != len(q.Questions) {
+		return fmt.Errorf("%w: questionnaire version %d has %d questions, got %d answers", ErrInvalidVector, q.Version, len(q.Questions), len(vector))
+	}
+	for i, question := range q.Questions {
+		if vector[i] < question.MinValue || vector[i] > question.MaxValue {
+			return fmt.Errorf("%w: answer %d to question %d must be between %d and %d", ErrInvalidVector, vector[i], i+1, question.MinValue, question.MaxValue)
+		}
+	}
+	return nil
+}
+
+// Return the questionnaire version the user's vector answers
+func GetUserQuestionnaireVersion(userID string, db *sql.DB) (int, error) {
+	var versionID int
+	err := db.QueryRow("SELECT COALESCE(questionnaire_version, ?) FROM users WHERE id = ?", ORIGINAL_QUESTIONNAIRE_VERSION, userID).Scan(&versionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("no questionnaire version found for user: %w", err)
+		}
+		return 0, fmt.Errorf("error querying questionnaire version: %w", err)
+	}
+	return versionID, nil
+}
+
+// Return the questionnaire version the vector of each user answers, given their userIDs
+func GetQuestionnaireVersions(userIDs []string, db *sql.DB) (map[string]int, error) {
+	versions := make(map[string]int)
+	if len(userIDs) == 0 {
+		return versions, nil
+	}
+
+	placeholders := make([]string, len(userIDs))
+	args := []interface{}{ORIGINAL_QUESTIONNAIRE_VERSION}
+	for i, id := range userIDs {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+
+	query := fmt.Sprintf(
+		"SELECT id, COALESCE(questionnaire_version, ?) FROM users WHERE id IN (%s)",
+		strings.Join(placeholders, ","),
+	)
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query questionnaire versions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		var versionID int
+		if err := rows.Scan(&userID, &versionID); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		versions[userID] = versionID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating questionnaire versions: %w", err)
+	}
+
+	return versions, nil
+}
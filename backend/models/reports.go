@@ -0,0 +1,142 @@
+/*
+Reports: users flagging other users for the moderation queue. Reports start open and an admin resolves or dismisses them.
+*/
+
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// reasons a user can give for a report
+var REPORT_REASONS = []string{"harassment", "spam", "fake_profile", "inappropriate", "safety", "other"}
+
+// states of a report in the moderation queue
+const (
+	ReportOpen      = "open"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+)
+
+var ErrReportNotFound = errors.New("report not found")
+var ErrReportClosed = errors.New("report is already closed")
+
+type Report struct {
+	ID           int     `json:"id"`
+	ReporterID   string  `json:"reporter_id"`
+	ReporterName string  `json:"reporter_name"`
+	ReportedID   string  `json:"reported_id"`
+	ReportedName string  `json:"reported_name"`
+	Reason       string  `json:"reason"`
+	Details      *string `json:"details"`
+	Status       string  `json:"status"`
+	Resolution   *string `json:"resolution"`
+	ReviewedBy   *string `json:"reviewed_by"`
+	ReviewedAt   *string `json:"reviewed_at"`
+	CreatedAt    string  `json:"created_at"`
+}
+
+// Add an open report by reporterID against reportedID. Returns the id of the report.
+func PostReport(reporterID string, reportedID string, reason string, details *string, db *sql.DB) (int64, error) {
+	result, err := db.Exec(`
+		INSERT INTO user_reports (reporter_id, reported_id, reason, details)
+		VALUES (?, ?, ?, ?)
+	`, reporterID, reportedID, reason, details)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert report: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get report id: %w", err)
+	}
+	return id, nil
+}
+
+// Return the reports with the given status, oldest first. An empty status returns every report.
+func GetReports(status string, db *sql.DB) ([]Report, error) {
+	rows, err := db.Query(`
+		SELECT r.id, r.reporter_id, COALESCE(reporter.name, ''), r.reported_id, COALESCE(reported.name, ''),
+			r.reason, r.details, r.status, r.resolution, r.reviewed_by, r.reviewed_at, r.created_at
+		FROM user_reports r
+		LEFT JOIN users reporter ON reporter.id = r.reporter_id
+		LEFT JOIN users reported ON reported.id = r.reported_id
+		WHERE ? = '' OR r.status = ?
+		ORDER BY r.created_at, r.id
+	`, status, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reports: %w", err)
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reports: %w", err)
+	}
+	return reports, nil
+}
+
+// Return a single report by id, or ErrReportNotFound
+func GetReportByID(reportID int, db *sql.DB) (Report, error) {
+	row := db.QueryRow(`
+		SELECT r.id, r.reporter_id, COALESCE(reporter.name, ''), r.reported_id, COALESCE(reported.name, ''),
+			r.reason, r.details, r.status, r.resolution, r.reviewed_by, r.reviewed_at, r.created_at
+		FROM user_reports r
+		LEFT JOIN users reporter ON reporter.id = r.reporter_id
+		LEFT JOIN users reported ON reported.id = r.reported_id
+		WHERE r.id = ?
+	`, reportID)
+	report, err := scanReport(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Report{}, ErrReportNotFound
+	}
+	return report, err
+}
+
+/*
+Close an open report as resolved or dismissed, recording the admin who reviewed it and an optional note.
+
+Returns ErrReportNotFound if there is no such report, and ErrReportClosed if it was already closed.
+*/
+func CloseReport(reportID int, status string, resolution *string, adminID string, db *sql.DB) (Report, error) {
+	result, err := db.Exec(`
+		UPDATE user_reports
+		SET status = ?, resolution = ?, reviewed_by = ?, reviewed_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = ?
+	`, status, resolution, adminID, reportID, ReportOpen)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to close report: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to count closed reports: %w", err)
+	}
+
+	report, err := GetReportByID(reportID, db)
+	if err != nil {
+		return Report{}, err
+	}
+	if rows == 0 {
+		return report, ErrReportClosed
+	}
+	return report, nil
+}
+
+// HELPER: scan a report from a row of GetReports or GetReportByID
+func scanReport(row interface{ Scan(...any) error }) (Report, error) {
+	var report Report
+	err := row.Scan(&report.ID, &report.ReporterID, &report.ReporterName, &report.ReportedID, &report.ReportedName,
+		&report.Reason, &report.Details, &report.Status, &report.Resolution, &report.ReviewedBy, &report.ReviewedAt, &report.CreatedAt)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to scan report: %w", err)
+	}
+	return report, nil
+}
@@ -6,16 +6,105 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
 )
 
+// environment variable that picks the metric used to compare quiz answers
+const SIMILARITY_METRIC_ENV = "SIMILARITY_METRIC"
+
+// names of the available similarity metrics
+const (
+	MetricSquared   = "squared"
+	MetricCosine    = "cosine"
+	MetricPearson   = "pearson"
+	MetricManhattan = "manhattan"
+)
+
+var (
+	ErrVectorLength  = errors.New("vectors have different lengths")
+	ErrUnknownMetric = errors.New("unknown similarity metric")
+	ErrInvalidScale  = errors.New("answer scale must have a higher max than min")
+)
+
+// AnswerScale is the lowest and highest answer a quiz question accepts
+type AnswerScale struct {
+	Min int
+	Max int
+}
+
+// scale of questions that do not say otherwise, which is what the original quiz used
+var DEFAULT_ANSWER_SCALE = AnswerScale{Min: 1, Max: 5}
+
+/*
+SimilarityMetric compares two answer vectors of the same length.
+Each answer is first placed on its question's scale (nil scales use DEFAULT_ANSWER_SCALE for every answer), so questions with longer scales do not count more.
+Each answer counts as much as its weight (nil weights count every answer equally, and a weight of 0 ignores the answer).
+Scores go from 0 (as different as the answer scales allow) to 1 (identical), so metrics can be swapped without changing how matches are ranked.
+*/
+type SimilarityMetric interface {
+	Name() string
+	Score(vec1, vec2 []int, weights []float64, scales []AnswerScale) (float64, error)
+}
+
+// SquaredDifferenceMetric sums the squared difference of each answer, relative to the largest possible sum
+type SquaredDifferenceMetric struct{}
+
+// CosineMetric compares the angle between the vectors, with each answer centered on the middle of the scale
+type CosineMetric struct{}
+
+// PearsonMetric compares how the answers of both users vary around their own average
+type PearsonMetric struct{}
+
+// ManhattanMetric sums the absolute difference of each answer, relative to the largest possible sum
+type ManhattanMetric struct{}
+
+// SimilarityMetricByName returns the metric called name, or ErrUnknownMetric
+func SimilarityMetricByName(name string) (SimilarityMetric, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case MetricSquared:
+		return SquaredDifferenceMetric{}, nil
+	case MetricCosine:
+		return CosineMetric{}, nil
+	case MetricPearson:
+		return PearsonMetric{}, nil
+	case MetricManhattan:
+		return ManhattanMetric{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMetric, name)
+	}
+}
+
+// ConfiguredSimilarityMetric returns the metric named by SIMILARITY_METRIC, falling back to the squared difference when it is unset or invalid
+func ConfiguredSimilarityMetric() SimilarityMetric {
+	value := os.Getenv(SIMILARITY_METRIC_ENV)
+	if value == "" {
+		return SquaredDifferenceMetric{}
+	}
+
+	metric, err := SimilarityMetricByName(value)
+	if err != nil {
+		log.Printf("Invalid %s provided (%s), using %s\n", SIMILARITY_METRIC_ENV, value, MetricSquared)
+		return SquaredDifferenceMetric{}
+	}
+	return metric
+}
+
 type Similarity struct {
 	UserID string
 	Score  float64
 }
 
 /*
-Find similarity between the current user and each user in the input list, and return a list of matches
+Find similarity between the current user and each user in the input list, and return a list of matches.
+The score is mutual: how well the other user's answers satisfy the current user, and the other way around, each weighted by what that user marked as important.
+Users who miss an answer the other user marked as mandatory are left out entirely.
+Users whose vector does not fit the current user's questionnaire (wrong length, or answers out of range) are logged and left out, instead of failing the whole computation.
+Users who answered another questionnaire version are left out too, since the same position can hold a different question.
 
 Params:
 
@@ -28,28 +117,67 @@ Returns:
 */
 func ComputeSimilarity(users []string, userID string, db *sql.DB) ([]Similarity, error) {
 
-	// STEP 1. get vectors for users and current user: GetVectors
+	// STEP 1. get vectors and importance for users and current user: GetVectors, GetImportances
 
 	vectors, err := GetVectors(users, db)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve vectors: %w", err)
 	}
+	importances, err := GetImportances(users, db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve importance: %w", err)
+	}
 
 	currentUserVector, err := GetUserVector(userID, db)
 	if err != nil {
-		return nil, fmt.Errorf("vector not found for current user ID: %s", userID[:8])
+		return nil, fmt.Errorf("vector not found for current user ID: %s", userID)
+	}
+	currentUserImportance, err := GetUserImportance(userID, db)
+	if err != nil {
+		return nil, fmt.Errorf("importance not found for current user ID: %s", userID)
+	}
+
+	// answers are compared on the scales of the questionnaire the current user answered
+	versionID, questionnaire, err := getUserQuestionnaire(userID, db)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := GetQuestionnaireVersions(users, db)
+	if err != nil {
+		return nil, err
+	}
+	var scales []AnswerScale
+	if questionnaire != nil {
+		if err := questionnaire.ValidateVector(currentUserVector); err != nil {
+			return nil, fmt.Errorf("vector of current user ID %s cannot be compared: %w", userID, err)
+		}
+		scales = questionnaire.Scales()
 	}
 
 	delete(vectors, userID) // If users also includes the current user
 
-	// STEP 2. calculate similarity for each user: FindSimilarity
+	// STEP 2. calculate mutual similarity for each user with the configured metric
+	metric := ConfiguredSimilarityMetric()
 	var similarityScores []Similarity
 	for user2ID, vector := range vectors {
-		score := FindSimilarity(currentUserVector, vector)
-		if score == -1 {
-			// check for mismatched vectors
-			return nil, fmt.Errorf("found a vector of the wrong length: %d", len(vector))
-		} else {
+		if versions[user2ID] != versionID {
+			// answers to another version cannot be compared question by question
+			log.Printf("Skipping user %s in similarity: answered questionnaire version %d, not %d\n", user2ID, versions[user2ID], versionID)
+			continue
+		}
+		if questionnaire != nil {
+			if err := questionnaire.ValidateVector(vector); err != nil {
+				// skip corrupt vectors, they are listed by GET /admin/vectors/invalid
+				log.Printf("Skipping user %s in similarity: %v\n", user2ID, err)
+				continue
+			}
+		}
+
+		score, ok, err := MutualSimilarity(metric, scales, currentUserVector, currentUserImportance, vector, importances[user2ID])
+		if err != nil {
+			log.Printf("Skipping user %s in similarity: %v\n", user2ID, err)
+			continue
+		} else if ok {
 			var similarity Similarity
 			similarity.UserID = user2ID
 			similarity.Score = score
@@ -60,17 +188,219 @@ func ComputeSimilarity(users []string, userID string, db *sql.DB) ([]Similarity,
 	return similarityScores, nil
 }
 
-// calculates similarity between two vectors (finds compatibility between two users) by summing the squares of the difference between each quiz answer
+// HELPER: the questionnaire version userID answered, and its questions, which are nil if that version has no questions on record
+func getUserQuestionnaire(userID string, db *sql.DB) (int, *Questionnaire, error) {
+	versionID, err := GetUserQuestionnaireVersion(userID, db)
+	if err != nil {
+		return 0, nil, err
+	}
+	questionnaire, err := GetQuestionnaire(versionID, db)
+	if err != nil {
+		if errors.Is(err, ErrQuestionnaireNotFound) {
+			return versionID, nil, nil
+		}
+		return 0, nil, err
+	}
+	return versionID, questionnaire, nil
+}
+
+/*
+MutualSimilarity scores two users against each other, OkCupid style: the geometric mean of how satisfied each user is with the other's answers, weighted by their own importance.
+
+Returns:
+
+	score float64
+	ok bool
+		false if either user answered differently to a question the other marked as mandatory
+*/
+func MutualSimilarity(metric SimilarityMetric, scales []AnswerScale, vec1 []int, importance1 []string, vec2 []int, importance2 []string) (float64, bool, error) {
+	if MandatoryMismatch(scales, vec1, importance1, vec2) || MandatoryMismatch(scales, vec2, importance2, vec1) {
+		return 0, false, nil
+	}
+
+	satisfaction1, err := metric.Score(vec1, vec2, ImportanceWeights(importance1, len(vec1)), scales)
+	if err != nil {
+		return 0, false, err
+	}
+	satisfaction2, err := metric.Score(vec2, vec1, ImportanceWeights(importance2, len(vec2)), scales)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return math.Sqrt(satisfaction1 * satisfaction2), true, nil
+}
+
+// calculates similarity between two vectors (finds compatibility between two users) with the squared difference metric. Returns -1 if the vectors have different lengths.
 func FindSimilarity(vec1, vec2 []int) float64 {
-	if len(vec1) != len(vec2) {
+	score, err := SquaredDifferenceMetric{}.Score(vec1, vec2, nil, nil)
+	if err != nil {
 		return -1
 	}
+	return score
+}
+
+func (SquaredDifferenceMetric) Name() string { return MetricSquared }
+
+func (SquaredDifferenceMetric) Score(vec1, vec2 []int, weights []float64, scales []AnswerScale) (float64, error) {
+	answers1, answers2, weights, err := normalizeAnswers(vec1, vec2, weights, scales)
+	if err != nil {
+		return 0, err
+	}
+	if weights == nil {
+		return 1, nil
+	}
+
+	// for 10 equally weighted answers on a 1-5 scale this is the sum of squared differences divided by 10 * 4^2 = 160
+	var squaredDifference, totalWeight float64
+	for i := range answers1 {
+		difference := answers1[i] - answers2[i]
+		squaredDifference += weights[i] * difference * difference
+		totalWeight += weights[i]
+	}
+
+	return clampScore(1 - squaredDifference/totalWeight), nil
+}
+
+func (CosineMetric) Name() string { return MetricCosine }
+
+func (CosineMetric) Score(vec1, vec2 []int, weights []float64, scales []AnswerScale) (float64, error) {
+	answers1, answers2, weights, err := normalizeAnswers(vec1, vec2, weights, scales)
+	if err != nil {
+		return 0, err
+	}
+	if weights == nil {
+		return 1, nil
+	}
+
+	// center the answers, otherwise all-positive answers always point the same way
+	var dot, norm1, norm2 float64
+	for i := range answers1 {
+		a := answers1[i] - 0.5
+		b := answers2[i] - 0.5
+		dot += weights[i] * a * b
+		norm1 += weights[i] * a * a
+		norm2 += weights[i] * b * b
+	}
+	if norm1 == 0 || norm2 == 0 {
+		// somebody answered neutral to everything, which says nothing either way
+		if norm1 == norm2 {
+			return 1, nil
+		}
+		return 0.5, nil
+	}
+
+	// map the cosine from [-1, 1] to [0, 1]
+	return clampScore((dot/math.Sqrt(norm1*norm2) + 1) / 2), nil
+}
 
-	var squaredDifference float64
+func (PearsonMetric) Name() string { return MetricPearson }
 
-	for i := 0; i < len(vec1); i++ {
-		squaredDifference += float64((vec1[i] - vec2[i]) * (vec1[i] - vec2[i]))
+func (PearsonMetric) Score(vec1, vec2 []int, weights []float64, scales []AnswerScale) (float64, error) {
+	answers1, answers2, weights, err := normalizeAnswers(vec1, vec2, weights, scales)
+	if err != nil {
+		return 0, err
+	}
+	if weights == nil {
+		return 1, nil
+	}
+
+	var mean1, mean2, totalWeight float64
+	for i := range answers1 {
+		mean1 += weights[i] * answers1[i]
+		mean2 += weights[i] * answers2[i]
+		totalWeight += weights[i]
+	}
+	mean1 /= totalWeight
+	mean2 /= totalWeight
+
+	var covariance, variance1, variance2 float64
+	for i := range answers1 {
+		a := answers1[i] - mean1
+		b := answers2[i] - mean2
+		covariance += weights[i] * a * b
+		variance1 += weights[i] * a * a
+		variance2 += weights[i] * b * b
+	}
+	if variance1 == 0 || variance2 == 0 {
+		// the correlation is undefined when somebody gave the same answer to everything, fall back to how far apart the answers are
+		return ManhattanMetric{}.Score(vec1, vec2, weights, scales)
 	}
 
-	return 1 - (squaredDifference / 160)
+	// map the correlation from [-1, 1] to [0, 1]
+	return clampScore((covariance/math.Sqrt(variance1*variance2) + 1) / 2), nil
+}
+
+func (ManhattanMetric) Name() string { return MetricManhattan }
+
+func (ManhattanMetric) Score(vec1, vec2 []int, weights []float64, scales []AnswerScale) (float64, error) {
+	answers1, answers2, weights, err := normalizeAnswers(vec1, vec2, weights, scales)
+	if err != nil {
+		return 0, err
+	}
+	if weights == nil {
+		return 1, nil
+	}
+
+	var difference, totalWeight float64
+	for i := range answers1 {
+		difference += weights[i] * math.Abs(answers1[i]-answers2[i])
+		totalWeight += weights[i]
+	}
+
+	return clampScore(1 - difference/totalWeight), nil
+}
+
+/*
+HELPER: make sure two vectors can be compared, and place every answer between 0 (bottom of its scale) and 1 (top of its scale).
+Fills in equal weights if none were given, and returns nil weights (and no error) when every answer has a weight of 0, in which case any answers are a perfect match.
+*/
+func normalizeAnswers(vec1, vec2 []int, weights []float64, scales []AnswerScale) ([]float64, []float64, []float64, error) {
+	if len(vec1) != len(vec2) {
+		return nil, nil, nil, fmt.Errorf("%w: %d and %d", ErrVectorLength, len(vec1), len(vec2))
+	}
+	if len(vec1) == 0 {
+		return nil, nil, nil, fmt.Errorf("%w: vectors are empty", ErrVectorLength)
+	}
+	if scales != nil && len(scales) != len(vec1) {
+		return nil, nil, nil, fmt.Errorf("%w: %d scales for %d answers", ErrVectorLength, len(scales), len(vec1))
+	}
+	if weights != nil && len(weights) != len(vec1) {
+		return nil, nil, nil, fmt.Errorf("%w: %d weights for %d answers", ErrVectorLength, len(weights), len(vec1))
+	}
+
+	answers1 := make([]float64, len(vec1))
+	answers2 := make([]float64, len(vec2))
+	filledWeights := make([]float64, len(vec1))
+	var totalWeight float64
+	for i := range vec1 {
+		scale := DEFAULT_ANSWER_SCALE
+		if scales != nil {
+			scale = scales[i]
+		}
+		if scale.Max <= scale.Min {
+			return nil, nil, nil, fmt.Errorf("%w: %d-%d", ErrInvalidScale, scale.Min, scale.Max)
+		}
+		span := float64(scale.Max - scale.Min)
+		answers1[i] = clampScore(float64(vec1[i]-scale.Min) / span)
+		answers2[i] = clampScore(float64(vec2[i]-scale.Min) / span)
+
+		filledWeights[i] = 1
+		if weights != nil {
+			filledWeights[i] = weights[i]
+		}
+		if filledWeights[i] < 0 {
+			return nil, nil, nil, fmt.Errorf("weights cannot be negative: %v", filledWeights[i])
+		}
+		totalWeight += filledWeights[i]
+	}
+
+	if totalWeight == 0 {
+		return answers1, answers2, nil, nil
+	}
+	return answers1, answers2, filledWeights, nil
+}
+
+// HELPER: keep a value between 0 and 1, in case an answer is outside of the scale
+func clampScore(score float64) float64 {
+	return math.Max(0, math.Min(1, score))
 }
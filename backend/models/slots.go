@@ -0,0 +1,330 @@
+/*
+Concrete availability: weekly availability expanded into real points in time, with availability exceptions applied on top
+*/
+
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// how many weeks ahead concrete overlapping slots are computed for matches
+const UPCOMING_WEEKS = 2
+
+// Slot is a concrete range of time [Start, End). Its JSON matches the body of POST /api/v1/dates, so a slot can be booked as is.
+type Slot struct {
+	Start time.Time `json:"date_start"`
+	End   time.Time `json:"date_end"`
+}
+
+// GetConcreteAvailability returns the time userID is available in [from, to): their weekly availability in their own time zone, plus "add" exceptions, minus "remove" exceptions
+func GetConcreteAvailability(userID string, from, to time.Time, db *sql.DB) ([]Slot, error) {
+	slots, err := getConcreteAvailabilities([]string{userID}, from, to, db)
+	if err != nil {
+		return nil, err
+	}
+	return slots[userID], nil
+}
+
+/*
+GetUpcomingOverlaps returns, for every other user, the concrete slots in [from, to) during which both they and userID are available,
+cut to the slot preferences of both users and aligned on userID's clock. Users without any overlapping slot that is long enough are left out.
+*/
+func GetUpcomingOverlaps(userID string, from, to time.Time, db *sql.DB) (map[string][]Slot, error) {
+	slots, err := getConcreteAvailabilities(nil, from, to, db)
+	if err != nil {
+		return nil, err
+	}
+	preferences, err := getSlotPreferences(nil, db)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := GetUserLocation(userID, db)
+	if err != nil {
+		return nil, err
+	}
+
+	overlaps := make(map[string][]Slot)
+	for otherUserID, otherSlots := range slots {
+		if otherUserID == userID {
+			continue
+		}
+		pairPreferences := combinePreferences(preferencesOf(preferences, userID), preferencesOf(preferences, otherUserID))
+		if overlap := fitSlots(intersectSlots(slots[userID], otherSlots), pairPreferences, loc); len(overlap) > 0 {
+			overlaps[otherUserID] = overlap
+		}
+	}
+	return overlaps, nil
+}
+
+/*
+AttachUpcomingSlots sets the UpcomingSlots of every match of userID to the concrete slots in [from, to) during which both users are available,
+leaving out the time either user already spends on a pending or confirmed date. Slots are cut to the slot preferences of both users and aligned on userID's clock.
+*/
+func AttachUpcomingSlots(matches []UserMatches, userID string, from, to time.Time, db *sql.DB) error {
+	if len(matches) == 0 {
+		return nil
+	}
+
+	userIDs := []string{userID}
+	for _, match := range matches {
+		userIDs = append(userIDs, match.OtherUserID(userID))
+	}
+	slots, err := getConcreteAvailabilities(userIDs, from, to, db)
+	if err != nil {
+		return err
+	}
+	booked, err := getBookedSlots(userIDs, from, to, db)
+	if err != nil {
+		return err
+	}
+	preferences, err := getSlotPreferences(userIDs, db)
+	if err != nil {
+		return err
+	}
+	loc, err := GetUserLocation(userID, db)
+	if err != nil {
+		return err
+	}
+
+	for i := range matches {
+		otherUserID := matches[i].OtherUserID(userID)
+		free := subtractSlots(intersectSlots(slots[userID], slots[otherUserID]), append(booked[userID], booked[otherUserID]...))
+		matches[i].UpcomingSlots = fitSlots(free, combinePreferences(preferencesOf(preferences, userID), preferencesOf(preferences, otherUserID)), loc)
+	}
+	return nil
+}
+
+// HELPER: the pending and confirmed dates in [from, to) of every user in userIDs
+func getBookedSlots(userIDs []string, from, to time.Time, db *sql.DB) (map[string][]Slot, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(userIDs)), ",")
+	args := []interface{}{StatusPending, StatusConfirmed, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339)}
+	for i := 0; i < 2; i++ {
+		for _, id := range userIDs {
+			args = append(args, id)
+		}
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT user1_id, user2_id, date_start, date_end
+		FROM scheduled_dates
+		WHERE status IN (?, ?)
+		AND JULIANDAY(date_end) > JULIANDAY(?)
+		AND JULIANDAY(date_start) < JULIANDAY(?)
+		AND (user1_id IN (%s) OR user2_id IN (%s))
+	`, placeholders, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get booked dates: %w", err)
+	}
+	defer rows.Close()
+
+	booked := make(map[string][]Slot)
+	for rows.Next() {
+		var user1ID, user2ID, startStr, endStr string
+		if err := rows.Scan(&user1ID, &user2ID, &startStr, &endStr); err != nil {
+			return nil, fmt.Errorf("failed to scan booked date: %w", err)
+		}
+		start, errStart := time.Parse(time.RFC3339, startStr)
+		end, errEnd := time.Parse(time.RFC3339, endStr)
+		if errStart != nil || errEnd != nil {
+			continue // validated on write, never expected
+		}
+		booked[user1ID] = append(booked[user1ID], Slot{Start: start, End: end})
+		booked[user2ID] = append(booked[user2ID], Slot{Start: start, End: end})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over booked dates: %w", err)
+	}
+	return booked, nil
+}
+
+// HELPER: compute the concrete availability in [from, to) of every user in userIDs, or of every user if userIDs is nil
+func getConcreteAvailabilities(userIDs []string, from, to time.Time, db *sql.DB) (map[string][]Slot, error) {
+	availabilityFilter, exceptionFilter := "", ""
+	var args []interface{}
+	if userIDs != nil {
+		if len(userIDs) == 0 {
+			return map[string][]Slot{}, nil
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(userIDs)), ",")
+		availabilityFilter = "WHERE a.user_id IN (" + placeholders + ")"
+		exceptionFilter = "AND user_id IN (" + placeholders + ")"
+		for _, id := range userIDs {
+			args = append(args, id)
+		}
+	}
+
+	// expand the weekly availability of every user in their own time zone
+	rows, err := db.Query(`
+		SELECT a.user_id, a.day_of_week, a.start_time, a.end_time, COALESCE(u.time_zone, '')
+		FROM availability a
+		LEFT JOIN users u ON u.id = a.user_id
+		`+availabilityFilter, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get availability: %w", err)
+	}
+	defer rows.Close()
+
+	added := make(map[string][]Slot)
+	for rows.Next() {
+		var a Availability
+		var timeZone string
+		if err := rows.Scan(&a.UserID, &a.DayOfWeek, &a.StartTime, &a.EndTime, &timeZone); err != nil {
+			return nil, fmt.Errorf("failed to scan availability: %w", err)
+		}
+		added[a.UserID] = append(added[a.UserID], expandWeekly(a, userLocation(timeZone), from, to)...)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over availability: %w", err)
+	}
+
+	// apply the exceptions that touch [from, to)
+	exceptionRows, err := db.Query(`
+		SELECT user_id, kind, exception_start, exception_end
+		FROM availability_exceptions
+		WHERE JULIANDAY(exception_end) > JULIANDAY(?)
+		AND JULIANDAY(exception_start) < JULIANDAY(?)
+		`+exceptionFilter, append([]interface{}{from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339)}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get availability exceptions: %w", err)
+	}
+	defer exceptionRows.Close()
+
+	removed := make(map[string][]Slot)
+	for exceptionRows.Next() {
+		var userID, kind, startStr, endStr string
+		if err := exceptionRows.Scan(&userID, &kind, &startStr, &endStr); err != nil {
+			return nil, fmt.Errorf("failed to scan availability exception: %w", err)
+		}
+		start, errStart := time.Parse(time.RFC3339, startStr)
+		end, errEnd := time.Parse(time.RFC3339, endStr)
+		if errStart != nil || errEnd != nil {
+			continue // validated on write, never expected
+		}
+
+		slot := Slot{Start: start, End: end}
+		if kind == ExceptionRemove {
+			removed[userID] = append(removed[userID], slot)
+		} else {
+			added[userID] = append(added[userID], slot)
+		}
+	}
+	if err := exceptionRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over availability exceptions: %w", err)
+	}
+
+	concrete := make(map[string][]Slot)
+	for userID, slots := range added {
+		window := []Slot{{Start: from, End: to}}
+		if free := subtractSlots(intersectSlots(mergeSlots(slots), window), removed[userID]); len(free) > 0 {
+			concrete[userID] = free
+		}
+	}
+	return concrete, nil
+}
+
+// HELPER: every occurrence in [from, to) of a weekly availability entry in loc
+func expandWeekly(a Availability, loc *time.Location, from, to time.Time) []Slot {
+	weekday, ok := parseWeekday(a.DayOfWeek)
+	start, okStart := parseClockMinutes(a.StartTime, false)
+	end, okEnd := parseClockMinutes(a.EndTime, true)
+	if !ok || !okStart || !okEnd || start >= end {
+		return nil
+	}
+
+	var slots []Slot
+	first := from.In(loc)
+	for day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc); day.Before(to); day = day.AddDate(0, 0, 1) {
+		if day.Weekday() != weekday {
+			continue
+		}
+		slots = append(slots, Slot{
+			Start: time.Date(day.Year(), day.Month(), day.Day(), 0, start, 0, 0, loc),
+			End:   time.Date(day.Year(), day.Month(), day.Day(), 0, end, 0, 0, loc),
+		})
+	}
+	return slots
+}
+
+// HELPER: weekly timeslots in UTC covering the given concrete slots, for users who only overlap through an exception
+func weeklyFromSlots(userID string, slots []Slot) []Availability {
+	var ranges []minuteRange
+	for _, slot := range slots {
+		start := slot.Start.UTC()
+		minutes := min(int(slot.End.Sub(slot.Start).Minutes()), MINUTES_PER_WEEK)
+		offset := weekdayIndex(start.Weekday())*MINUTES_PER_DAY + start.Hour()*60 + start.Minute()
+		ranges = append(ranges, wrapWeekRange(minuteRange{offset, offset + minutes})...)
+	}
+
+	var availabilities []Availability
+	for _, r := range mergeRanges(ranges) {
+		availabilities = append(availabilities, availabilityFromWeekRange(userID, r, time.UTC, time.Now())...)
+	}
+	return availabilities
+}
+
+// HELPER: sort slots and merge the ones that touch or overlap
+func mergeSlots(slots []Slot) []Slot {
+	sorted := append([]Slot(nil), slots...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	var merged []Slot
+	for _, slot := range sorted {
+		if n := len(merged); n > 0 && !slot.Start.After(merged[n-1].End) {
+			if slot.End.After(merged[n-1].End) {
+				merged[n-1].End = slot.End
+			}
+			continue
+		}
+		merged = append(merged, slot)
+	}
+	return merged
+}
+
+// HELPER: intersect two sets of slots
+func intersectSlots(a, b []Slot) []Slot {
+	var overlaps []Slot
+	for _, x := range mergeSlots(a) {
+		for _, y := range mergeSlots(b) {
+			start, end := x.Start, x.End
+			if y.Start.After(start) {
+				start = y.Start
+			}
+			if y.End.Before(end) {
+				end = y.End
+			}
+			if start.Before(end) {
+				overlaps = append(overlaps, Slot{Start: start, End: end})
+			}
+		}
+	}
+	return overlaps
+}
+
+// HELPER: remove every slot in removed from slots
+func subtractSlots(slots, removed []Slot) []Slot {
+	free := mergeSlots(slots)
+	for _, r := range mergeSlots(removed) {
+		var remaining []Slot
+		for _, slot := range free {
+			if !r.Start.Before(slot.End) || !r.End.After(slot.Start) {
+				remaining = append(remaining, slot)
+				continue
+			}
+			if slot.Start.Before(r.Start) {
+				remaining = append(remaining, Slot{Start: slot.Start, End: r.Start})
+			}
+			if r.End.Before(slot.End) {
+				remaining = append(remaining, Slot{Start: r.End, End: slot.End})
+			}
+		}
+		free = remaining
+	}
+	return free
+}
@@ -0,0 +1,218 @@
+/*
+Time zone handling for weekly availability. Availability rows are stored in their owner's time zone, overlaps between users are computed in UTC,
+and results are rendered back in whatever zone the viewer asks for.
+*/
+
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// time zone of users who never set one
+const DEFAULT_TIME_ZONE = "America/Los_Angeles"
+
+const MINUTES_PER_WEEK = 7 * MINUTES_PER_DAY
+
+var ErrInvalidTimeZone = errors.New("invalid time zone, must be an IANA time zone such as America/Los_Angeles")
+
+// LoadTimeZone loads an IANA time zone by name, refusing the empty and "Local" zones which depend on the server
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, ErrInvalidTimeZone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrInvalidTimeZone
+	}
+	return loc, nil
+}
+
+// GetUserLocation returns the time zone of userID, falling back to DEFAULT_TIME_ZONE if it is not set or invalid
+func GetUserLocation(userID string, db *sql.DB) (*time.Location, error) {
+	var name sql.NullString
+	err := db.QueryRow("SELECT time_zone FROM users WHERE id = ?", userID).Scan(&name)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get time zone of user %s: %w", userID, err)
+	}
+	return userLocation(name.String), nil
+}
+
+/*
+ConvertAvailability re-expresses weekly availability stored in the zone from in the zone to, using the current UTC offset of both zones.
+Entries keep their id. An entry that crosses midnight once converted is split into two entries with the same id.
+*/
+func ConvertAvailability(availabilities []Availability, from, to *time.Location) []Availability {
+	now := time.Now()
+	converted := []Availability{}
+	for _, a := range availabilities {
+		for _, r := range weekRanges(a, from, now) {
+			for _, local := range availabilityFromWeekRange(a.UserID, r, to, now) {
+				local.ID = a.ID
+				converted = append(converted, local)
+			}
+		}
+	}
+	return converted
+}
+
+/*
+MergeAvailability re-expresses weekly availability stored in the zone from in the zone to, merging the touching or overlapping entries of each user.
+Merged entries have no id, which is how overlaps are returned by GetAllAvailable and the matches table.
+*/
+func MergeAvailability(availabilities []Availability, from, to *time.Location) []Availability {
+	now := time.Now()
+	rangesByUser := make(map[string][]minuteRange)
+	var userIDs []string
+	for _, a := range availabilities {
+		if _, seen := rangesByUser[a.UserID]; !seen {
+			userIDs = append(userIDs, a.UserID)
+		}
+		rangesByUser[a.UserID] = append(rangesByUser[a.UserID], weekRanges(a, from, now)...)
+	}
+
+	merged := []Availability{}
+	for _, userID := range userIDs {
+		for _, r := range mergeRanges(rangesByUser[userID]) {
+			merged = append(merged, availabilityFromWeekRange(userID, r, to, now)...)
+		}
+	}
+	return merged
+}
+
+// HELPER: resolve a stored time zone name, falling back to the default zone
+func userLocation(name string) *time.Location {
+	if loc, err := LoadTimeZone(name); err == nil {
+		return loc
+	}
+	loc, err := time.LoadLocation(DEFAULT_TIME_ZONE)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// HELPER: UTC offset of loc at the moment ref, in minutes
+func offsetMinutes(loc *time.Location, ref time.Time) int {
+	_, offset := ref.In(loc).Zone()
+	return offset / 60
+}
+
+// HELPER: days of the week starting on Monday, the start of a week range
+func weekdayIndex(weekday time.Weekday) int {
+	return (int(weekday) + 6) % 7
+}
+
+// HELPER: parse a day_of_week value such as "Monday"
+func parseWeekday(name string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if day.String() == name {
+			return day, true
+		}
+	}
+	return time.Sunday, false
+}
+
+// HELPER: parse an HH:MM:SS (or HH:MM) time into minutes after midnight, rounding partial minutes up if roundUp is set
+func parseClockMinutes(clock string, roundUp bool) (int, bool) {
+	t, err := time.Parse("15:04:05", clock)
+	if err != nil {
+		if t, err = time.Parse("15:04", clock); err != nil {
+			return 0, false
+		}
+	}
+	minutes := t.Hour()*60 + t.Minute()
+	if roundUp && t.Second() > 0 {
+		minutes++
+	}
+	return minutes, true
+}
+
+/*
+HELPER: turn a weekly availability entry in loc into ranges of minutes after Monday 00:00 UTC, using the UTC offset of loc at ref.
+A range that wraps around the end of the week is split in two. Returns nothing for malformed entries.
+*/
+func weekRanges(a Availability, loc *time.Location, ref time.Time) []minuteRange {
+	weekday, ok := parseWeekday(a.DayOfWeek)
+	start, okStart := parseClockMinutes(a.StartTime, false)
+	end, okEnd := parseClockMinutes(a.EndTime, true)
+	if !ok || !okStart || !okEnd || start >= end {
+		return nil
+	}
+
+	shift := weekdayIndex(weekday)*MINUTES_PER_DAY - offsetMinutes(loc, ref)
+	return wrapWeekRange(minuteRange{start + shift, end + shift})
+}
+
+// HELPER: bring a range back inside of [0, MINUTES_PER_WEEK), splitting it if it wraps around the end of the week
+func wrapWeekRange(r minuteRange) []minuteRange {
+	for r.start < 0 {
+		r.start += MINUTES_PER_WEEK
+		r.end += MINUTES_PER_WEEK
+	}
+	for r.start >= MINUTES_PER_WEEK {
+		r.start -= MINUTES_PER_WEEK
+		r.end -= MINUTES_PER_WEEK
+	}
+	if r.end <= MINUTES_PER_WEEK {
+		return []minuteRange{r}
+	}
+	return []minuteRange{{r.start, MINUTES_PER_WEEK}, {0, r.end - MINUTES_PER_WEEK}}
+}
+
+// HELPER: render a UTC week range as weekly availability entries in loc, one per day it touches
+func availabilityFromWeekRange(userID string, r minuteRange, loc *time.Location, ref time.Time) []Availability {
+	shift := offsetMinutes(loc, ref)
+	var availabilities []Availability
+	for _, local := range wrapWeekRange(minuteRange{r.start + shift, r.end + shift}) {
+		// split at every local midnight
+		for start := local.start; start < local.end; {
+			day := start / MINUTES_PER_DAY
+			end := min(local.end, (day+1)*MINUTES_PER_DAY)
+			availabilities = append(availabilities, Availability{
+				UserID:    userID,
+				DayOfWeek: time.Weekday((day + 1) % 7).String(),
+				StartTime: formatMinutes(start - day*MINUTES_PER_DAY),
+				EndTime:   formatMinutes(end - day*MINUTES_PER_DAY),
+			})
+			start = end
+		}
+	}
+	return availabilities
+}
+
+// HELPER: sort ranges and merge the ones that touch or overlap
+func mergeRanges(ranges []minuteRange) []minuteRange {
+	sorted := append([]minuteRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].start < sorted[j].start
+	})
+
+	var merged []minuteRange
+	for _, r := range sorted {
+		if n := len(merged); n > 0 && r.start <= merged[n-1].end {
+			merged[n-1].end = max(merged[n-1].end, r.end)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// HELPER: intersect two sets of ranges
+func intersectRanges(a, b []minuteRange) []minuteRange {
+	var overlaps []minuteRange
+	for _, x := range mergeRanges(a) {
+		for _, y := range mergeRanges(b) {
+			start, end := max(x.start, y.start), min(x.end, y.end)
+			if start < end {
+				overlaps = append(overlaps, minuteRange{start, end})
+			}
+		}
+	}
+	return overlaps
+}
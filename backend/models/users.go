@@ -3,8 +3,10 @@ package models
 import (
 	"database/sql"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt" // Import log package for logging
+	"time"
 )
 
 // User struct representing a user profile
@@ -15,12 +17,95 @@ type User struct {
 	Bio            string  `json:"bio"`
 	Vector         *string `json:"vector"`
 	ProfilePicture string  `json:"profile_picture"`
+	TimeZone       string  `json:"time_zone"` // IANA time zone the user's availability is expressed in
+
+	MinDateMinutes         int `json:"min_date_minutes"`         // shortest overlap offered as a date
+	SlotGranularityMinutes int `json:"slot_granularity_minutes"` // length overlaps are cut to multiples of
+
+	CancellationCount int `json:"cancellation_count"` // confirmed dates this user cancelled, maintained by CancelDate
+
+	// profile attributes used by the match filters, empty if not given
+	Gender    string   `json:"gender"`     // one of GENDERS
+	Seeking   []string `json:"seeking"`    // genders the user wants to be matched with, empty for anyone
+	BirthDate string   `json:"birth_date"` // YYYY-MM-DD
+	ClassYear int      `json:"class_year"` // expected graduation year
+	Major     string   `json:"major"`
+}
+
+/*
+PublicUser is the profile of a user as other users see it.
+The match filter inputs (gender, seeking, birth date, class year, major), the slot preferences and the cancellation count stay private: only the age is derived from the birth date.
+*/
+type PublicUser struct {
+	ID             string  `json:"id"`
+	Name           string  `json:"name"`
+	Email          string  `json:"email"`
+	Bio            string  `json:"bio"`
+	Vector         *string `json:"vector"`
+	ProfilePicture string  `json:"profile_picture"`
+	TimeZone       string  `json:"time_zone"`
+	Age            *int    `json:"age"` // nil if the user did not give their birth date
+}
+
+// Public returns the profile of u that other users are allowed to see
+func (u User) Public() PublicUser {
+	public := PublicUser{
+		ID:             u.ID,
+		Name:           u.Name,
+		Email:          u.Email,
+		Bio:            u.Bio,
+		Vector:         u.Vector,
+		ProfilePicture: u.ProfilePicture,
+		TimeZone:       u.TimeZone,
+	}
+	if birthDate, err := time.Parse(time.DateOnly, u.BirthDate); err == nil {
+		age := ageOn(birthDate, time.Now())
+		public.Age = &age
+	}
+	return public
+}
+
+// HELPER: age in whole years on the day of now, the same way the match filters compute it
+func ageOn(birthDate time.Time, now time.Time) int {
+	age := now.Year() - birthDate.Year()
+	if now.Format("01-02") < birthDate.Format("01-02") {
+		age--
+	}
+	return age
+}
+
+// columns selected for a user, in the order scanUser expects them
+const userColumns = "id, name, email, bio, vector, profile_picture, time_zone, min_date_minutes, slot_granularity_minutes, cancellation_count, " +
+	"COALESCE(gender, ''), seeking, COALESCE(birth_date, ''), COALESCE(class_year, 0), COALESCE(major, '')"
+
+// HELPER: scan a row selected with userColumns
+func scanUser(row interface{ Scan(...any) error }) (User, error) {
+	var u User
+	var profilePicture []byte
+	var seekingJSON sql.NullString
+
+	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Bio, &u.Vector, &profilePicture, &u.TimeZone, &u.MinDateMinutes, &u.SlotGranularityMinutes, &u.CancellationCount,
+		&u.Gender, &seekingJSON, &u.BirthDate, &u.ClassYear, &u.Major)
+	if err != nil {
+		return User{}, err
+	}
+
+	// Convert BLOB to base64 string
+	u.ProfilePicture = base64.StdEncoding.EncodeToString(profilePicture)
+
+	u.Seeking = []string{}
+	if seekingJSON.Valid && seekingJSON.String != "" {
+		if err := json.Unmarshal([]byte(seekingJSON.String), &u.Seeking); err != nil {
+			return User{}, fmt.Errorf("failed to unmarshal seeking: %w", err)
+		}
+	}
+	return u, nil
 }
 
 // GetAllUsers fetches alsl profiles from the database
 func GetAllUsers(db *sql.DB) ([]User, error) {
 	// Query to get all users and their profile information
-	rows, err := db.Query("SELECT id, name, email, bio, vector, profile_picture FROM users")
+	rows, err := db.Query("SELECT " + userColumns + " FROM users")
 	if err != nil {
 		return nil, fmt.Errorf("error executing query %w", err)
 	}
@@ -28,17 +113,11 @@ func GetAllUsers(db *sql.DB) ([]User, error) {
 
 	var users []User
 	for rows.Next() {
-		var u User
-		var profilePicture []byte
-
-		err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Bio, &u.Vector, &profilePicture)
+		u, err := scanUser(rows)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning row: %w", err)
 		}
 
-		// Convert BLOB to base64 string
-		u.ProfilePicture = base64.StdEncoding.EncodeToString(profilePicture)
-
 		users = append(users, u)
 	}
 
@@ -48,13 +127,10 @@ func GetAllUsers(db *sql.DB) ([]User, error) {
 // GetUserByID fetches a single user profile from the database by ID
 func GetUserByID(userID string, db *sql.DB) (User, error) {
 	// Query to get the user's profile information
-	row := db.QueryRow("SELECT id, name, email, bio, vector, profile_picture FROM users WHERE id = ?", userID)
-
-	var u User
-	var profilePicture []byte
+	row := db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", userID)
 
 	// Scan the row into the User struct
-	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Bio, &u.Vector, &profilePicture)
+	u, err := scanUser(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return User{}, fmt.Errorf("user with ID %s not found: %w", userID, err)
@@ -63,28 +139,31 @@ func GetUserByID(userID string, db *sql.DB) (User, error) {
 		return User{}, err
 	}
 
-	// Convert BLOB to base64 string
-	u.ProfilePicture = base64.StdEncoding.EncodeToString(profilePicture)
 	return u, nil
 }
 
 func PostUser(user User, db *sql.DB) error {
+	if user.TimeZone == "" {
+		user.TimeZone = DEFAULT_TIME_ZONE
+	}
+
 	_, err := db.Exec(`
-		INSERT INTO users (id, name, email, bio, profile_picture)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO users (id, name, email, bio, profile_picture, time_zone)
+		VALUES (?, ?, ?, ?, ?, ?)
 	`,
 		user.ID,
 		user.Name,
 		user.Email,
 		user.Bio,
 		user.ProfilePicture,
+		user.TimeZone,
 	)
 
 	if err != nil {
 		return fmt.Errorf("error executing statement: %w", err)
 	}
-	
-	return nil;
+
+	return nil
 }
 
 // update user information
@@ -110,6 +189,43 @@ func PatchUser(user User, db *sql.DB) error {
 		query += " profile_picture = ?,"
 		args = append(args, user.ProfilePicture)
 	}
+	if user.TimeZone != "" {
+		query += " time_zone = ?,"
+		args = append(args, user.TimeZone)
+	}
+	if user.MinDateMinutes != 0 {
+		query += " min_date_minutes = ?,"
+		args = append(args, user.MinDateMinutes)
+	}
+	if user.SlotGranularityMinutes != 0 {
+		query += " slot_granularity_minutes = ?,"
+		args = append(args, user.SlotGranularityMinutes)
+	}
+	if user.Gender != "" {
+		query += " gender = ?,"
+		args = append(args, user.Gender)
+	}
+	if user.Seeking != nil {
+		// an empty list is an update too: it means anyone
+		seekingJSON, err := json.Marshal(user.Seeking)
+		if err != nil {
+			return fmt.Errorf("failed to convert seeking to JSON: %w", err)
+		}
+		query += " seeking = ?,"
+		args = append(args, string(seekingJSON))
+	}
+	if user.BirthDate != "" {
+		query += " birth_date = ?,"
+		args = append(args, user.BirthDate)
+	}
+	if user.ClassYear != 0 {
+		query += " class_year = ?,"
+		args = append(args, user.ClassYear)
+	}
+	if user.Major != "" {
+		query += " major = ?,"
+		args = append(args, user.Major)
+	}
 	// If no fields were provided, error
 	if len(args) == 0 {
 		return errors.New("no valid fields to update")
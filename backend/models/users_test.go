@@ -0,0 +1,40 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAgeOn(t *testing.T) {
+	birthDate := time.Date(2000, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		now  time.Time
+		want int
+	}{
+		{time.Date(2026, 12, 30, 0, 0, 0, 0, time.UTC), 25},
+		{time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC), 26},
+		{time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), 26},
+	}
+	for _, test := range tests {
+		if got := ageOn(birthDate, test.now); got != test.want {
+			t.Errorf("ageOn(%s) = %d, want %d", test.now.Format(time.DateOnly), got, test.want)
+		}
+	}
+}
+
+func TestPublicUser(t *testing.T) {
+	user := User{ID: "user-1", Name: "Alice", TimeZone: "America/Los_Angeles", BirthDate: "2000-01-01", Gender: "woman", CancellationCount: 3}
+	public := user.Public()
+	if public.ID != user.ID || public.Name != user.Name || public.TimeZone != user.TimeZone {
+		t.Errorf("Public() = %+v, want the public fields of %+v", public, user)
+	}
+	if public.Age == nil || *public.Age != ageOn(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), time.Now()) {
+		t.Errorf("Public().Age = %v, want the age of a user born on %s", public.Age, user.BirthDate)
+	}
+
+	user.BirthDate = ""
+	if age := user.Public().Age; age != nil {
+		t.Errorf("Public().Age = %d without a birth date, want nil", *age)
+	}
+}
@@ -3,7 +3,9 @@ package models
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"strings"
 )
 
@@ -33,14 +35,46 @@ func GetUserVector(userID string, db *sql.DB) ([]int, error) {
 	return vector, nil
 }
 
-// update similarity vector for the current user
-func UpdateUserVector(vector []int, userID string, db *sql.DB) error {
+/*
+update similarity vector for the current user, along with the questionnaire version it answers and the importance of each answer. Returns ErrInvalidVector if the vector does not fit that version.
+A nil importance keeps the stored importance if the vector answers the same questionnaire version as before, and clears it otherwise, since it was declared for other questions.
+Everything is written in a single statement, so the answers are never stored with the importance of other answers.
+*/
+func UpdateUserVector(vector []int, importance []string, versionID int, userID string, db *sql.DB) error {
+	// never store a vector other users cannot be compared against
+	questionnaire, err := GetQuestionnaire(versionID, db)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve questionnaire version %d: %w", versionID, err)
+	}
+	if err := questionnaire.ValidateVector(vector); err != nil {
+		return err
+	}
+
 	vectorJSON, err := json.Marshal(vector)
 	if err != nil {
 		return fmt.Errorf("failed to convert vector to JSON: %w", err)
 	}
 
-	_, err = db.Exec("UPDATE users SET vector = ? WHERE id = ?", vectorJSON, userID)
+	var importanceJSON []byte
+	if importance != nil {
+		importanceJSON, err = json.Marshal(importance)
+		if err != nil {
+			return fmt.Errorf("failed to convert importance to JSON: %w", err)
+		}
+	}
+
+	// the right-hand sides all see the row as it was before the update
+	_, err = db.Exec(`
+		UPDATE users
+		SET vector = ?,
+			importance = CASE
+				WHEN ? THEN ?
+				WHEN COALESCE(questionnaire_version, ?) = ? THEN importance
+				ELSE NULL
+			END,
+			questionnaire_version = ?
+		WHERE id = ?
+	`, vectorJSON, importance != nil, string(importanceJSON), ORIGINAL_QUESTIONNAIRE_VERSION, versionID, versionID, userID)
 	if err != nil {
 		return fmt.Errorf("failed to convert update user vector: %w", err)
 	}
@@ -89,15 +123,20 @@ func GetVectors(userIDs []string, db *sql.DB) (map[string][]int, error) {
 	users := make(map[string][]int)
 	for rows.Next() {
 		var userID string
-		var vectorJSON string
+		var vectorJSON sql.NullString
 		if err := rows.Scan(&userID, &vectorJSON); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
-		// Decode the JSON vector field
+		// Decode the JSON vector field, skipping missing and corrupt ones so one user cannot break everyone's matches
+		if !vectorJSON.Valid {
+			log.Printf("Skipping missing vector of user %s\n", userID)
+			continue
+		}
 		var vector []int
-		if err := json.Unmarshal([]byte(vectorJSON), &vector); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal vector: %w", err)
+		if err := json.Unmarshal([]byte(vectorJSON.String), &vector); err != nil {
+			log.Printf("Skipping corrupt vector of user %s: %v\n", userID, err)
+			continue
 		}
 
 		users[userID] = vector
@@ -105,3 +144,92 @@ func GetVectors(userIDs []string, db *sql.DB) (map[string][]int, error) {
 
 	return users, nil
 }
+
+// a user whose stored vector cannot be compared against other users
+type InvalidVector struct {
+	UserID               string  `json:"user_id"`
+	Name                 string  `json:"name"`
+	Vector               *string `json:"vector"` // as stored, since it may not even be valid JSON
+	QuestionnaireVersion int     `json:"questionnaire_version"`
+	Reason               string  `json:"reason"`
+}
+
+/*
+Find every user whose vector is missing, is not a JSON array of ints, or does not fit the questionnaire version it claims to answer
+
+Returns:
+
+	[]InvalidVector
+		ordered by user id
+*/
+func GetInvalidVectors(db *sql.DB) ([]InvalidVector, error) {
+	rows, err := db.Query(`
+		SELECT id, name, vector, COALESCE(questionnaire_version, ?)
+		FROM users
+		ORDER BY id
+	`, ORIGINAL_QUESTIONNAIRE_VERSION)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user vectors: %w", err)
+	}
+
+	type storedVector struct {
+		InvalidVector
+		vectorJSON sql.NullString
+	}
+	var stored []storedVector
+	for rows.Next() {
+		var row storedVector
+		if err := rows.Scan(&row.UserID, &row.Name, &row.vectorJSON, &row.QuestionnaireVersion); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		stored = append(stored, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user vectors: %w", err)
+	}
+
+	// look up each questionnaire version once, after the rows are closed
+	questionnaires := make(map[int]*Questionnaire)
+	invalid := []InvalidVector{}
+	for _, row := range stored {
+		if row.vectorJSON.Valid {
+			row.Vector = &row.vectorJSON.String
+		}
+
+		questionnaire, ok := questionnaires[row.QuestionnaireVersion]
+		if !ok {
+			questionnaire, err = GetQuestionnaire(row.QuestionnaireVersion, db)
+			if err != nil && !errors.Is(err, ErrQuestionnaireNotFound) {
+				return nil, err
+			}
+			questionnaires[row.QuestionnaireVersion] = questionnaire
+		}
+
+		row.Reason = vectorProblem(row.vectorJSON, questionnaire)
+		if row.Reason != "" {
+			invalid = append(invalid, row.InvalidVector)
+		}
+	}
+
+	return invalid, nil
+}
+
+// HELPER: describe what is wrong with a stored vector, or "" if nothing is
+func vectorProblem(vectorJSON sql.NullString, questionnaire *Questionnaire) string {
+	if !vectorJSON.Valid {
+		return "vector is missing"
+	}
+	var vector []int
+	if err := json.Unmarshal([]byte(vectorJSON.String), &vector); err != nil {
+		return fmt.Sprintf("vector is not a JSON array of ints: %v", err)
+	}
+	if questionnaire == nil {
+		return "questionnaire version does not exist"
+	}
+	if err := questionnaire.ValidateVector(vector); err != nil {
+		return err.Error()
+	}
+	return ""
+}
@@ -4,19 +4,27 @@ import (
 	"database/sql"
 	"go-react-backend/handlers"
 	"go-react-backend/middleware"
+	"go-react-backend/workers"
 
 	"github.com/gorilla/mux"
 )
 
-func RegisterRoutes(r *mux.Router, db *sql.DB) {
+func RegisterRoutes(r *mux.Router, db *sql.DB, matchQueue *workers.MatchQueue) {
 	// Add middleware
 	r.Use(middleware.DbMiddleware(db))
+	r.Use(middleware.MatchQueueMiddleware(matchQueue))
 	r.Use(middleware.AuthMiddleware)
 
 	// query users table
 	r.HandleFunc("/users", handlers.GetAllUsersHandler).Methods("GET")
 	r.HandleFunc("/users/me", handlers.GetCurrentUserHandler).Methods("GET")
+	r.HandleFunc("/users/me/filters", handlers.GetMatchFiltersHandler).Methods("GET")
+	r.HandleFunc("/users/me/filters", handlers.PutMatchFiltersHandler).Methods("PUT")
+	r.HandleFunc("/users/me/blocks", handlers.GetBlocksHandler).Methods("GET")
 	r.HandleFunc("/users/{userId}", handlers.GetUserHandler).Methods("GET")
+	r.HandleFunc("/users/{userId}/block", handlers.PostBlockHandler).Methods("POST")
+	r.HandleFunc("/users/{userId}/block", handlers.DeleteBlockHandler).Methods("DELETE")
+	r.HandleFunc("/users/{userId}/report", handlers.PostReportHandler).Methods("POST")
 	r.HandleFunc("/users", handlers.PostUserHandler).Methods("POST")
 	r.HandleFunc("/users", handlers.PatchUserHandler).Methods("PATCH")
 	r.HandleFunc("/users", handlers.DeleteUserHandler).Methods("DELETE")
@@ -26,6 +34,17 @@ func RegisterRoutes(r *mux.Router, db *sql.DB) {
 	r.HandleFunc("/availability", handlers.PostAvailabilityHandler).Methods("POST")
 	r.HandleFunc("/availability", handlers.PutAvailabilityHandler).Methods("PUT")
 	r.HandleFunc("/availability", handlers.DeleteAvailabilityHandler).Methods("DELETE")
+	r.HandleFunc("/availability/bulk", handlers.PutAvailabilityBulkHandler).Methods("PUT")
+	r.HandleFunc("/availability/import", handlers.ImportAvailabilityHandler).Methods("POST")
+
+	// query availability exceptions of the current user
+	r.HandleFunc("/availability/exceptions", handlers.GetAvailabilityExceptionsHandler).Methods("GET")
+	r.HandleFunc("/availability/exceptions", handlers.PostAvailabilityExceptionHandler).Methods("POST")
+	r.HandleFunc("/availability/exceptions", handlers.PutAvailabilityExceptionHandler).Methods("PUT")
+	r.HandleFunc("/availability/exceptions", handlers.DeleteAvailabilityExceptionHandler).Methods("DELETE")
+
+	// query the active compatibility quiz
+	r.HandleFunc("/quiz", handlers.GetQuizHandler).Methods("GET")
 
 	// query similarity vector for the current user
 	r.HandleFunc("/vector", handlers.GetVectorHandler).Methods("GET")
@@ -33,6 +52,14 @@ func RegisterRoutes(r *mux.Router, db *sql.DB) {
 
 	// query for matches
 	r.HandleFunc("/matches", handlers.GetMatchesHandler).Methods("GET")
+	r.HandleFunc("/matches/status", handlers.GetMatchStatusHandler).Methods("GET")
+	r.HandleFunc("/matches/{userId}/explain", handlers.GetMatchExplanationHandler).Methods("GET")
+	r.HandleFunc("/matches/{userId}/{action:like|pass}", handlers.PostMatchActionHandler).Methods("POST")
+
+	// export dates as iCalendar (registered before /dates/{status} so it does not swallow "<id>.ics")
+	r.HandleFunc("/dates.ics", handlers.GetDatesCalendarHandler).Methods("GET")                // Export all dates
+	r.HandleFunc("/dates/{dateId:[0-9]+}.ics", handlers.GetDateCalendarHandler).Methods("GET") // Export a single date
+	r.HandleFunc("/dates/feed-token", handlers.PostCalendarTokenHandler).Methods("POST")       // Create a calendar feed url
 
 	// query for dates
 	r.HandleFunc("/dates", handlers.GetDatesHandler).Methods("GET")          // Gets all dates
@@ -40,10 +67,37 @@ func RegisterRoutes(r *mux.Router, db *sql.DB) {
 	r.HandleFunc("/dates", handlers.PostDateHandler).Methods("POST")         // Create new pending date for the user
 	r.HandleFunc("/dates", handlers.PatchDateHandler).Methods("PATCH")       // Update the status for a date
 	r.HandleFunc("/dates/{dateId:[0-9]+}", handlers.DeleteDateHandler).Methods("DELETE")
+	r.HandleFunc("/dates/{dateId:[0-9]+}/cancel", handlers.CancelDateHandler).Methods("POST")         // Cancel a confirmed date
+	r.HandleFunc("/dates/{dateId:[0-9]+}/reschedule", handlers.RescheduleDateHandler).Methods("POST") // Move a confirmed date to a new time
+
+	// negotiate dates proposed with several candidate slots
+	r.HandleFunc("/dates/proposals", handlers.PostDateProposalHandler).Methods("POST")                          // Propose a new date with several slots
+	r.HandleFunc("/dates/{dateId:[0-9]+}/proposals", handlers.GetDateProposalsHandler).Methods("GET")           // Get the negotiation history
+	r.HandleFunc("/dates/{dateId:[0-9]+}/proposals", handlers.CounterDateProposalHandler).Methods("POST")       // Counter with a new set of slots
+	r.HandleFunc("/dates/{dateId:[0-9]+}/proposals/accept", handlers.AcceptDateProposalHandler).Methods("POST") // Accept one of the slots
+
+	// feedback once a date is over
+	r.HandleFunc("/dates/{dateId:[0-9]+}/feedback", handlers.PostDateFeedbackHandler).Methods("POST")
 
 	// sync users data with supabase
 	r.HandleFunc("/webhooks/users", handlers.UserSyncWebhookHandler).Methods("POST")
 	r.HandleFunc("/webhooks/users", handlers.UserSyncWebhookHandler).Methods("PUT")
 	r.HandleFunc("/webhooks/users", handlers.UserSyncWebhookHandler).Methods("DELETE")
 
+	// admin reports and moderation, only for users listed in ADMIN_USER_IDS
+	adminRouter := r.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(middleware.AdminMiddleware)
+	adminRouter.HandleFunc("/vectors/invalid", handlers.GetInvalidVectorsHandler).Methods("GET")
+	adminRouter.HandleFunc("/reports", handlers.GetReportsHandler).Methods("GET")
+	adminRouter.HandleFunc("/reports/{reportId:[0-9]+}", handlers.PatchReportHandler).Methods("PATCH")
+
+}
+
+// Routes that do not need a JWT: each handler authenticates the request itself
+func RegisterPublicRoutes(r *mux.Router, db *sql.DB) {
+	// Add middleware
+	r.Use(middleware.DbMiddleware(db))
+
+	// calendar feed, authenticated by the token in the url
+	r.HandleFunc("/calendar/{token:[0-9a-f]+}.ics", handlers.GetCalendarFeedHandler).Methods("GET")
 }
@@ -0,0 +1,96 @@
+/*
+Background sweeper that expires pending dates nobody answered in time
+*/
+
+package workers
+
+import (
+	"database/sql"
+	"go-react-backend/models"
+	"log"
+	"os"
+	"time"
+)
+
+// defaults used when the environment does not configure the sweeper
+const (
+	DEFAULT_SWEEP_INTERVAL   = 5 * time.Minute
+	DEFAULT_PENDING_DATE_TTL = 7 * 24 * time.Hour
+)
+
+// DateSweeper periodically moves stale pending dates to "expired"
+type DateSweeper struct {
+	db       *sql.DB
+	interval time.Duration // how often to sweep
+	maxAge   time.Duration // how long a date can stay pending, 0 to only expire dates that already started
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewDateSweeper creates a sweeper, configured by PENDING_DATE_SWEEP_INTERVAL and PENDING_DATE_TTL (Go durations, e.g. "10m" or "72h") in .env
+func NewDateSweeper(db *sql.DB) *DateSweeper {
+	interval := durationFromEnv("PENDING_DATE_SWEEP_INTERVAL", DEFAULT_SWEEP_INTERVAL)
+	if interval == 0 {
+		interval = DEFAULT_SWEEP_INTERVAL
+	}
+
+	return &DateSweeper{
+		db:       db,
+		interval: interval,
+		maxAge:   durationFromEnv("PENDING_DATE_TTL", DEFAULT_PENDING_DATE_TTL),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start sweeping in the background, once right away and then every interval
+func (s *DateSweeper) Start() {
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			s.sweep()
+			select {
+			case <-ticker.C:
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the sweeper and wait for the current sweep to finish
+func (s *DateSweeper) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+// HELPER: expire stale dates once
+func (s *DateSweeper) sweep() {
+	expired, err := models.ExpireStaleDates(s.maxAge, time.Now(), s.db)
+	if err != nil {
+		log.Printf("Failed to expire pending dates: %v\n", err)
+		return
+	}
+	if expired > 0 {
+		log.Printf("Expired %d pending dates\n", expired)
+	}
+}
+
+// HELPER: read a duration from the environment, falling back to a default if it is missing or invalid
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		log.Printf("Invalid %s provided (%s), using %s\n", key, value, fallback)
+		return fallback
+	}
+	return duration
+}
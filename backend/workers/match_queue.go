@@ -0,0 +1,233 @@
+/*
+Background queue that recomputes the stored matches of users, so requests that change matches do not wait for them
+*/
+
+package workers
+
+import (
+	"container/list"
+	"database/sql"
+	"go-react-backend/models"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// workers used when MATCH_WORKERS is not configured
+const DEFAULT_MATCH_WORKERS = 2
+
+// statuses kept in memory. Past this, the statuses of the jobs that finished longest ago are forgotten, and those users show as idle again
+const MAX_JOB_STATUSES = 10000
+
+// states of a user's match job
+const (
+	JobIdle    = "idle"    // nothing queued, matches were never recomputed by this server or the status was forgotten
+	JobQueued  = "queued"  // waiting for a worker
+	JobRunning = "running" // a worker is recomputing the matches
+	JobDone    = "done"    // the last recompute finished
+	JobFailed  = "failed"  // the last recompute returned an error
+)
+
+// MatchJobStatus is what the queue knows about the match job of a user
+type MatchJobStatus struct {
+	UserID     string     `json:"user_id"`
+	State      string     `json:"state"`
+	Rerun      bool       `json:"rerun"` // triggered again while running, so it runs once more after the current run
+	QueuedAt   *time.Time `json:"queued_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Error      string     `json:"error,omitempty"`
+
+	refreshOnly bool          // only rebuild the user's own stored matches, without updating the other users' (see EnqueueRefresh)
+	finished    *list.Element // position in MatchQueue.finished, nil unless the job is done or failed
+}
+
+// MatchQueue recomputes matches with a pool of workers. Triggers for a user who is already queued are coalesced into one job.
+type MatchQueue struct {
+	db       *sql.DB
+	workers  int
+	mu       sync.Mutex
+	wake     *sync.Cond
+	order    []string                   // users waiting for a worker, oldest first
+	jobs     map[string]*MatchJobStatus // latest status of the users the queue has seen, at most MAX_JOB_STATUSES
+	finished *list.List                 // user IDs of the done and failed jobs, the one that finished longest ago first
+	stopped  bool
+	wg       sync.WaitGroup
+}
+
+// NewMatchQueue creates a queue, with MATCH_WORKERS (a positive integer) workers from .env
+func NewMatchQueue(db *sql.DB) *MatchQueue {
+	q := &MatchQueue{
+		db:       db,
+		workers:  intFromEnv("MATCH_WORKERS", DEFAULT_MATCH_WORKERS),
+		jobs:     make(map[string]*MatchJobStatus),
+		finished: list.New(),
+	}
+	q.wake = sync.NewCond(&q.mu)
+	return q
+}
+
+// Start the workers in the background
+func (q *MatchQueue) Start() {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// Stop the workers and wait for the running jobs to finish. Jobs still queued are dropped.
+func (q *MatchQueue) Stop() {
+	q.mu.Lock()
+	q.stopped = true
+	if len(q.order) > 0 {
+		log.Printf("Dropping %d queued match jobs\n", len(q.order))
+	}
+	q.wake.Broadcast()
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+/*
+Enqueue a recompute of userID's matches. Never blocks.
+If the user is already queued nothing changes, and if their job is running it runs once more afterwards, so the result reflects every trigger.
+*/
+func (q *MatchQueue) Enqueue(userID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := q.job(userID)
+	switch job.State {
+	case JobQueued:
+		job.refreshOnly = false
+		return
+	case JobRunning:
+		job.Rerun = true
+		return
+	}
+	q.push(job, false)
+}
+
+/*
+EnqueueRefresh enqueues a rebuild of userID's own stored matches, without updating the stored matches of the users they match with. Never blocks.
+For reads that find the stored matches missing or stale: nothing changed, so the other users' matches are still right.
+Nothing happens if a job of the user is already queued or running, since it rebuilds their matches anyway.
+*/
+func (q *MatchQueue) EnqueueRefresh(userID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := q.job(userID)
+	if job.State == JobQueued || job.State == JobRunning {
+		return
+	}
+	q.push(job, true)
+}
+
+// Status returns a copy of the latest status of userID's match job
+func (q *MatchQueue) Status(userID string) MatchJobStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if job, exists := q.jobs[userID]; exists {
+		return *job
+	}
+	return MatchJobStatus{UserID: userID, State: JobIdle}
+}
+
+// HELPER: run jobs until the queue is stopped
+func (q *MatchQueue) work() {
+	defer q.wg.Done()
+
+	for {
+		q.mu.Lock()
+		for len(q.order) == 0 && !q.stopped {
+			q.wake.Wait()
+		}
+		if q.stopped {
+			q.mu.Unlock()
+			return
+		}
+		userID := q.order[0]
+		q.order = q.order[1:]
+		job := q.jobs[userID]
+		started := time.Now()
+		job.State = JobRunning
+		job.StartedAt = &started
+		job.Error = ""
+		update := models.UpdateMatches
+		if job.refreshOnly {
+			update = models.RefreshMatches
+		}
+		q.mu.Unlock()
+
+		err := update(userID, q.db)
+
+		q.mu.Lock()
+		finished := time.Now()
+		job.FinishedAt = &finished
+		job.State = JobDone
+		if err != nil {
+			log.Printf("Failed to update matches of %s: %v\n", userID, err)
+			job.State = JobFailed
+			job.Error = err.Error()
+		}
+		if job.Rerun {
+			job.Rerun = false
+			q.push(job, false)
+		} else {
+			job.finished = q.finished.PushBack(userID)
+			q.evictFinished()
+		}
+		q.mu.Unlock()
+	}
+}
+
+// HELPER: the status of userID's job, created as idle if the queue has not seen them yet. q.mu must be held.
+func (q *MatchQueue) job(userID string) *MatchJobStatus {
+	job, exists := q.jobs[userID]
+	if !exists {
+		job = &MatchJobStatus{UserID: userID, State: JobIdle}
+		q.jobs[userID] = job
+	}
+	return job
+}
+
+// HELPER: forget the statuses of the jobs that finished longest ago until at most MAX_JOB_STATUSES are kept. q.mu must be held.
+func (q *MatchQueue) evictFinished() {
+	// jobs that are queued or running are never in q.finished, so they are kept even past the limit
+	for len(q.jobs) > MAX_JOB_STATUSES && q.finished.Len() > 0 {
+		userID := q.finished.Remove(q.finished.Front()).(string)
+		delete(q.jobs, userID)
+	}
+}
+
+// HELPER: put a job at the back of the queue and wake a worker. A job that only refreshes the user's own matches sets refreshOnly. q.mu must be held.
+func (q *MatchQueue) push(job *MatchJobStatus, refreshOnly bool) {
+	if job.finished != nil {
+		q.finished.Remove(job.finished)
+		job.finished = nil
+	}
+	queued := time.Now()
+	job.State = JobQueued
+	job.refreshOnly = refreshOnly
+	job.QueuedAt = &queued
+	q.order = append(q.order, job.UserID)
+	q.wake.Signal()
+}
+
+// HELPER: read a positive integer from the environment, falling back to a default if it is missing or invalid
+func intFromEnv(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid %s provided (%s), using %d\n", key, value, fallback)
+		return fallback
+	}
+	return n
+}
@@ -13,7 +13,10 @@ import { useAuth } from '../AuthContext';
  *   @param {string} match.user1_id - ID of current user.
  *   @param {string} match.user2_id - ID of the second user in the match.
  *   @param {number} match.similarity_score - the similarity between the users.
+ *   @param {boolean} match.liked - whether the current user liked the second user.
+ *   @param {boolean} match.mutual - whether both users liked each other.
  *   @param {Array<Object>} match.availabilities - Array of availability objects
+ *   @param {Object} [match.explanation] - breakdown of the similarity score, only when the matches were fetched with explain=true.
  * 
  * @param {Object} availability - An individual availability object within a match
  *   @param {number} availability.id - Always zero
@@ -120,6 +123,11 @@ function MatchOption({ match, onSchedule }) {
     const [showSchedules, setShowSchedules] = useState(false);
     const [dateScheduled, setDateScheduled] = useState(false);
     const [scheduleButtons, setScheduleButtons] = useState([]);
+    const [liked, setLiked] = useState(match.liked || false);
+    const [mutual, setMutual] = useState(match.mutual || false);
+    const [passed, setPassed] = useState(false);
+    const [explanation, setExplanation] = useState(match.explanation || null); // breakdown of the similarity score
+    const [showExplanation, setShowExplanation] = useState(false);
 
     const triggerToast = (message) => {
         setToastMessage(message);
@@ -229,6 +237,40 @@ function MatchOption({ match, onSchedule }) {
         setDateScheduled(true);
     }
 
+    // Like or pass on the match. Passed matches are hidden and never shown again
+    async function actOnMatch(action) {
+        function handleResponse(data) {
+            if (action === 'pass') {
+                setPassed(true);
+                return;
+            }
+            setLiked(true);
+            setMutual(data.mutual);
+            triggerToast(data.mutual ? "It's mutual!" : 'Liked!');
+        }
+        function handleError(error) {
+            console.error(`Failed to ${action} match`, error);
+        }
+        await dbPostRequest(`/matches/${match.user2_id}/${action}`, {}, handleResponse, handleError, isAuthenticated, getSupabaseClient);
+    }
+
+    // Show why the users were matched, fetching the breakdown the first time
+    async function toggleExplanation() {
+        if (showExplanation) {
+            setShowExplanation(false);
+            return;
+        }
+        if (!explanation) {
+            function handleError(error) {
+                console.error('Failed to explain match', error);
+            }
+            await dbGetRequest(`/matches/${match.user2_id}/explain`, (data) => setExplanation(data.explanation), handleError, isAuthenticated, getSupabaseClient);
+        }
+        setShowExplanation(true);
+    }
+
+    if (passed) return null;
+
     return (
         <div className="bg-white-100 border border-gray-300 rounded-lg p-6 flex flex-col items-center w-[250px] h-[550px]">
             <div className="flex flex-col items-center space-y-4 flex-grow">
@@ -267,6 +309,17 @@ function MatchOption({ match, onSchedule }) {
                         <div className="w-16 h-16">
                             <RingComponent N={match.similarity_score} />
                         </div>
+                        <button onClick={toggleExplanation} className="text-xs text-blue-600 hover:underline">
+                            {showExplanation ? "Hide" : "Why this match?"}
+                        </button>
+                        {showExplanation && explanation && (
+                            <div className="text-xs text-gray-600 text-center">
+                                <p>{Math.round(explanation.overlap_minutes_per_week / 60 * 10) / 10} hours free together each week</p>
+                                {explanation.shared_interests.length > 0 && (
+                                    <p>You both: {explanation.shared_interests.join(', ')}</p>
+                                )}
+                            </div>
+                        )}
                     </>
                 )}
             </div>
@@ -282,6 +335,21 @@ function MatchOption({ match, onSchedule }) {
                     </button>
                 )))}
             </div>
+            <div className="flex w-full space-x-2 mb-2">
+                <button
+                    onClick={() => actOnMatch('pass')}
+                    className="border border-gray-400 text-gray-600 hover:bg-gray-100 transition px-4 py-2 rounded w-full text-sm"
+                >
+                    Pass
+                </button>
+                <button
+                    onClick={() => actOnMatch('like')}
+                    disabled={liked}
+                    className="border border-pink-500 text-pink-600 hover:bg-pink-50 transition px-4 py-2 rounded w-full text-sm disabled:opacity-60"
+                >
+                    {mutual ? "Mutual" : liked ? "Liked" : "Like"}
+                </button>
+            </div>
             <button 
                 onClick={() => setShowSchedules(!showSchedules)}
                 className="bg-blue-600 text-white hover:bg-blue-700 transition px-4 py-2 rounded w-full text-sm mb-auto"
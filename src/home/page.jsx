@@ -7,6 +7,7 @@ import { dbGetRequest } from '../api/db';
 import FindDatePage from './FindDatePage';
 import PendingDatePage from './PendingDatePage';
 
+const MATCHES_PAGE_SIZE = 20; // matches loaded at once
 
 /**
  * Dates Homepage
@@ -17,6 +18,8 @@ import PendingDatePage from './PendingDatePage';
 export default function HomePage() {
     const [ view, setView ] = useState('find');
     const [ matches, setMatches ] = useState([]); // potential matches for the user
+    const [ nextCursor, setNextCursor ] = useState(null); // where the next page of matches starts, null on the last page
+    const [ totalMatches, setTotalMatches ] = useState(0); // how many matches the user has
     const [ dates, setDates ] = useState([]);  // pending and confirmed dates
     const [ currentUser, setCurrentUser ] = useState([]);  // pending and confirmed dates
     const { isAuthenticated, getSupabaseClient } = useAuth();
@@ -32,22 +35,50 @@ export default function HomePage() {
     {        
         await dbGetRequest('/dates', setDatesData, setError, isAuthenticated, getSupabaseClient);
     }
+    // appends the next page of matches
+    async function loadMoreMatches()
+    {
+        function addMatchesPage(page) {
+            setMatches((current) => [ ...current, ...page.matches ]);
+            setNextCursor(page.next_cursor);
+            setTotalMatches(page.total);
+        }
+        const cursor = encodeURIComponent(nextCursor);
+        await dbGetRequest(`/matches?count=${MATCHES_PAGE_SIZE}&cursor=${cursor}`, addMatchesPage, setError, isAuthenticated, getSupabaseClient);
+    }
     // Load dates and matches data on page load
     useEffect(() => {
-        // extracts matches data
-        function setMatchesData(data) {
-            setMatches(data);
+        // extracts the first page of matches
+        function setMatchesData(page) {
+            setMatches(page.matches);
+            setNextCursor(page.next_cursor);
+            setTotalMatches(page.total);
         }
         function setUser(data) {
             setCurrentUser(data);
         }
+        // matches are computed in the background, so reload them once the server is done
+        let statusTimer = null;
+        let waited = false;
+        function checkMatchStatus(status) {
+            if (status.state === 'queued' || status.state === 'running') {
+                waited = true;
+                statusTimer = setTimeout(() => {
+                    dbGetRequest('/matches/status', checkMatchStatus, setError, isAuthenticated, getSupabaseClient);
+                }, 1000);
+            } else if (waited) {
+                dbGetRequest(`/matches?count=${MATCHES_PAGE_SIZE}`, setMatchesData, setError, isAuthenticated, getSupabaseClient);
+            }
+        }
         const fetchData = async () => {
             await getDateData();
             await dbGetRequest('/users/me', setUser, setError, isAuthenticated, getSupabaseClient);
-            await dbGetRequest('/matches', setMatchesData, setError, isAuthenticated, getSupabaseClient);
+            await dbGetRequest(`/matches?count=${MATCHES_PAGE_SIZE}`, setMatchesData, setError, isAuthenticated, getSupabaseClient);
+            await dbGetRequest('/matches/status', checkMatchStatus, setError, isAuthenticated, getSupabaseClient);
         };
         fetchData();
-    
+
+        return () => clearTimeout(statusTimer);
     }, [ isAuthenticated, getSupabaseClient ]);
 
     return (
@@ -82,7 +113,19 @@ export default function HomePage() {
 
                 <div className="mt-4">
                     {view === 'find' ? (
-                        <FindDatePage matches={matches} reloadDates={getDateData} />
+                        <div>
+                            <FindDatePage matches={matches} reloadDates={getDateData} />
+                            {nextCursor && (
+                                <div className="flex justify-center mt-4">
+                                    <button
+                                        className="px-4 py-2 text-blue-600 border border-blue-600 rounded hover:bg-blue-50"
+                                        onClick={loadMoreMatches}
+                                    >
+                                        Load more matches ({matches.length} of {totalMatches})
+                                    </button>
+                                </div>
+                            )}
+                        </div>
                     ) : (
                         <PendingDatePage dates={dates} user={ currentUser } />
                     )}
@@ -15,29 +15,32 @@ export default function QuizPage() {
     const [resetKey, setResetKey] = useState(0); // increment to force rerender when reset
     const [toastMessage, setToastMessage] = useState("");
     const [showToast, setShowToast] = useState(false);
-    const contents=[
-        ["How much do you talk?", "Mute", "Fluent in Yapanese"],
-        ["How much do you like your alone time?", "Always with people", "Always alone"],
-        ["How much do you like/listen to music?", "What is a song", "Can't live without music"],
-        ["How much do you like/play sports?", "I don't go outside", "D1 athlete"],
-        ["Do you enjoy partying/drinking?", "Never", "Wilding every night"],
-        ["How chill are you?", "Not so easygoing", "Easygoing"],
-        ["STEM or art?", "Art", "STEM"],
-        ["How would you describe your life currently?", "Absolute clownery", "Have life together"],
-        ["How fast is your response time?", "Several days", "Immediately"],
-        ["What do you enjoy doing?", "Watching a movie in bed", "Adventuring in the Alps"]
-    ]
-    const [scores, setScores] = useState(Array(contents.length).fill(null))
+    const [questions, setQuestions] = useState([]) // active quiz version, served by the backend
+    const [scores, setScores] = useState([])
+    const [importance, setImportance] = useState([])
     const [user, setUser] = useState({
-        similarity_vector: Array(contents.length).fill(null)
+        similarity_vector: []
     })
 
     useEffect(() => {
         const fetchUserData = async () => {
             try {
+                let count = 0;
+                await dbGetRequest('/quiz', (data) => {
+                    count = data.questions.length;
+                    setQuestions(data.questions);
+                    setScores(Array(count).fill(null));
+                    setImportance(Array(count).fill("a little"));
+                }, handleFetchError, isAuthenticated, getSupabaseClient);
                 await dbGetRequest('/vector', (data) => {
                     setUser(data);
-                    setScores(data.similarity_vector || Array(contents.length).fill(null));
+                    // answers to an older quiz do not line up with the current questions
+                    if (!data.stale && data.similarity_vector) {
+                        setScores(data.similarity_vector);
+                    }
+                    if (!data.stale && data.importance) {
+                        setImportance(data.importance);
+                    }
                 }, handleFetchError, isAuthenticated, getSupabaseClient);
             } catch (error) {
                 console.error("Failed to fetch user information on page load:", error);
@@ -58,6 +61,12 @@ export default function QuizPage() {
         setScores(updatedScores);
     };
 
+    const handleImportanceChange = (index, value) => {
+        const updatedImportance = [...importance];
+        updatedImportance[index] = value;
+        setImportance(updatedImportance);
+    };
+
     const handleSubmit = async (e) => {
         e.preventDefault();
         setIsSubmitted(true);
@@ -70,13 +79,14 @@ export default function QuizPage() {
         console.error("booo", error)
         }
 
-        await dbPutRequest('/vector', { similarity_vector: scores }, handleResponse, handleError, isAuthenticated, getSupabaseClient);
+        await dbPutRequest('/vector', { similarity_vector: scores, importance: importance }, handleResponse, handleError, isAuthenticated, getSupabaseClient);
         triggerToast("Quiz submitted!")
     };
     
     const handleReset = () => {
         setIsSubmitted(false);
-        setScores(Array(contents.length).fill(null));
+        setScores(Array(questions.length).fill(null));
+        setImportance(Array(questions.length).fill("a little"));
         setResetKey((prev) => prev + 1);
     }
 
@@ -103,10 +113,10 @@ export default function QuizPage() {
             <div className="min-h-screen py-8 px-4">
             <h1 className="text-2xl font-bold text-center mb-6 text-gray-800 max-w-2xl mx-auto p-4">Compatibility Quiz</h1>
             {!isSubmitted ? <div>
-                <h1 className="text-lg text-gray-600 mb-8 text-center max-w-3xl mx-auto">Our quiz has ten questions designed to assess your values and strengths. We use the results to match you with people whose results suggest a high compatibility score with you. </h1>
+                <h1 className="text-lg text-gray-600 mb-8 text-center max-w-3xl mx-auto">Our quiz has {questions.length} questions designed to assess your values and strengths. We use the results to match you with people whose results suggest a high compatibility score with you. </h1>
                 <form onSubmit={handleSubmit} className="space-y-6">
-                    {[0, 1, 2, 3, 4, 5, 6, 7, 8, 9].map((value) => (
-                        <Question key={`question${value}-${resetKey}`}  name={value} contents={contents[value]} onChange={handleScoreChange}/>
+                    {questions.map((question, value) => (
+                        <Question key={`question${value}-${resetKey}`}  name={value} question={question} onChange={handleScoreChange} importance={importance[value]} onImportanceChange={handleImportanceChange}/>
                     ))}
                     <div className="flex justify-center py-4">
                         <button
@@ -143,7 +153,7 @@ export default function QuizPage() {
     );
 };
 
-function Question({ name, contents, initialSelected, onChange }) {
+function Question({ name, question, initialSelected, onChange, importance, onImportanceChange }) {
     const [selectedValue, setSelectedValue] = useState(initialSelected);
 
     useEffect(() => {
@@ -157,11 +167,11 @@ function Question({ name, contents, initialSelected, onChange }) {
     };
     return (
         <div className="max-w-4xl mx-auto p-8 border-t-2">
-        <h2 className="text-blue-600 text-lg font-semibold text-center mb-10">{contents[0]}</h2>
+        <h2 className="text-blue-600 text-lg font-semibold text-center mb-10">{question.prompt}</h2>
         <div className="flex items-center">
-            <span className="basis-1/6 text-gray-500 font-medium text-center">{contents[1]}</span>
+            <span className="basis-1/6 text-gray-500 font-medium text-center">{question.min_label}</span>
             <ul className="basis-2/3 flex space-x-4 items-center justify-center">
-            {[1, 2, 3, 4, 5].map((value) => (
+            {Array.from({ length: question.max_value - question.min_value + 1 }, (_, i) => question.min_value + i).map((value) => (
                 <Option
                 key={value}
                 name={name}
@@ -171,7 +181,21 @@ function Question({ name, contents, initialSelected, onChange }) {
                 />
             ))}
             </ul>
-            <span className="basis-1/6 text-gray-500 font-medium text-center">{contents[2]}</span>
+            <span className="basis-1/6 text-gray-500 font-medium text-center">{question.max_label}</span>
+        </div>
+        <div className="flex justify-center items-center mt-6 space-x-2">
+            <label htmlFor={`importance${name}`} className="text-gray-500 font-medium">How much does this matter to you?</label>
+            <select
+                id={`importance${name}`}
+                className="border border-gray-300 rounded px-2 py-1 text-gray-700"
+                value={importance}
+                onChange={(e) => onImportanceChange(name, e.target.value)}
+            >
+                <option value="irrelevant">Irrelevant</option>
+                <option value="a little">A little</option>
+                <option value="very">Very</option>
+                <option value="mandatory">Mandatory</option>
+            </select>
         </div>
         </div>
     );